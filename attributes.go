@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+)
+
+/*
+	Attributes are read from the .gogitattributes file at the root of the
+	working directory. Every line is a pattern, matched like the ones of
+	.gogitignore, followed by attributes:
+
+	- "binary" or "-text" marks the matching files as binary
+	- "text" or "-binary" marks them as text even if they contain NUL bytes
+
+	Later lines take precedence. Files without one of these attributes are
+	binary if a NUL byte is found in their first 8000 bytes.
+*/
+
+const AttributesFile = ".gogitattributes"
+
+// binarySniffLength is the number of bytes looked at to detect binary content
+const binarySniffLength = 8000
+
+type AttributeRule struct {
+	Rule   IgnoreRule // Pattern of the rule
+	Binary bool       // Whether the matching files are binary
+}
+
+type Attributes struct {
+	rules []AttributeRule
+}
+
+// GetAttributes reads the attributes file of the working directory
+func GetAttributes() *Attributes {
+	b, err := ioutil.ReadFile(AttributesFile)
+	if err != nil {
+		return &Attributes{}
+	}
+	return &Attributes{ParseAttributesFile(string(b))}
+}
+
+func ParseAttributesFile(content string) []AttributeRule {
+	var rules []AttributeRule
+	for i, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		patterns := ParseIgnoreFile(".", AttributesFile, fields[0])
+		if len(patterns) == 0 || patterns[0].Negate {
+			continue
+		}
+		patterns[0].Line = i + 1
+		for _, attribute := range fields[1:] {
+			switch attribute {
+			case "binary", "-text":
+				rules = append(rules, AttributeRule{patterns[0], true})
+			case "text", "-binary":
+				rules = append(rules, AttributeRule{patterns[0], false})
+			}
+		}
+	}
+	return rules
+}
+
+// IsBinary returns true if the file at relativePath with the content is
+// binary
+func (a *Attributes) IsBinary(relativePath string, content []byte) bool {
+	for i := len(a.rules) - 1; i >= 0; i-- {
+		if a.rules[i].Rule.Matches(relativePath, false) {
+			return a.rules[i].Binary
+		}
+	}
+	return IsBinaryContent(content)
+}
+
+// IsBinaryBlob is like IsBinary for a stored blob, "" is never binary
+func (a *Attributes) IsBinaryBlob(relativePath string, hash string) bool {
+	if hash == "" {
+		return false
+	}
+	return a.IsBinary(relativePath, ReadBlob(hash))
+}
+
+// IsBinaryContent returns true if the content has a NUL byte in its first
+// bytes
+func IsBinaryContent(content []byte) bool {
+	if len(content) > binarySniffLength {
+		content = content[:binarySniffLength]
+	}
+	return bytes.IndexByte(content, 0) != -1
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 )
 
@@ -28,6 +27,9 @@ func DeleteBranch(branch string) {
 
 func RenameBranch(oldBranch, newBranch string) {
 	os.Rename(".gogit/branches/"+oldBranch, ".gogit/branches/"+newBranch)
+	if GetHeadBranch() == oldBranch {
+		SaveHeadBranch(newBranch)
+	}
 }
 
 func LogAllBranches() {
@@ -52,20 +54,3 @@ func GetAllBranchHeads() *[]string {
 	}
 	return &commitHashes
 }
-
-func GetHeadBranch() string {
-	f, err := os.Open(".gogit/HEAD_BRANCH")
-	if err != nil {
-		panic(err)
-	}
-	return FileToString(f)
-}
-
-func SaveHeadBranch(branch string) {
-	ioutil.WriteFile(".gogit/HEAD_BRANCH", []byte(branch), 0666)
-}
-
-func UpdateHeadBranch(commitHash string) {
-	branch := GetHeadBranch()
-	CreateBranch(branch, commitHash)
-}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
+	"time"
+
+	"gogit/diff"
 
 	"github.com/spf13/cobra"
 )
@@ -16,12 +18,51 @@ var (
 	cos bool
 	lcs bool
 	jac bool
+
+	repackAll bool
+	commitAll bool
+	rmCached  bool
+	resetHard bool
+	porcelain bool
+	verbose   bool
+	unified   int
+	diffStat  bool
+	algorithm string
+
+	mergeContinue  bool
+	mergeAbort     bool
+	mergeBaseAll   bool
+	noFF           bool
+	ffOnly         bool
+	strategy       string
+	strategyOpt    string
+	checkoutOurs   bool
+	checkoutTheirs bool
+	logPatch       bool
+	rebaseContinue bool
+	rebaseSkip     bool
+	rebaseAbort    bool
+	interactive    bool
+	pickContinue   bool
+	pickAbort      bool
+	force          bool
+	autostash      bool
+	stashMessage   string
+	stashUntracked bool
+	stashPatch     bool
+	tagAnnotate    bool
+	tagMessage     string
+	tagDelete      bool
+	tagSubjects    bool
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "gogit",
 	Short: "A simple VCS",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		Initialize()
+	},
 }
 
 var commitCmd = &cobra.Command{
@@ -29,11 +70,20 @@ var commitCmd = &cobra.Command{
 	Short: "Commit changes to the repository",
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		if checkInProgress() {
+			return
+		}
 		commits := *GetAllCommits()
 		var newCommit *Commit
 		message := strings.Join(args[0:], " ")
+		if commitAll && !HasConflicts() {
+			StageTracked()
+		}
 		if len(commits) == 0 {
 			newCommit = CreateCommit("user", message, []*Commit{})
+			if newCommit == nil {
+				return
+			}
 			CreateBranch("MASTER", newCommit.Hash)
 			SaveHeadBranch("MASTER")
 		} else {
@@ -44,24 +94,175 @@ var commitCmd = &cobra.Command{
 		if newCommit != nil {
 			commits = append(commits, *newCommit)
 			SaveHead(newCommit)
-			UpdateHeadBranch(newCommit.Hash)
 		}
 		SaveConfig(&commits)
 	},
 }
 
+var addCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Stage files for the next commit",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		AddToIndex(args)
+		MarkResolved(args)
+	},
+}
+
+var rmCmd = &cobra.Command{
+	Use:   "rm",
+	Short: "Remove files from the working directory and the staging area",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		RemoveFromIndex(args, rmCached)
+		MarkResolved(args)
+	},
+}
+
+var resetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Unstage files",
+	Run: func(cmd *cobra.Command, args []string) {
+		if resetHard {
+			runResetHard(args)
+			return
+		}
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		ResetIndex(args)
+	},
+}
+
+// runResetHard discards the uncommitted changes to tracked files and the
+// conflicts left by applying a stash
+func runResetHard(args []string) {
+	if len(args) != 0 {
+		fmt.Println("--hard doesn't take paths")
+		return
+	}
+	if command := InProgress(); command != "" && command != "stash" {
+		fmt.Printf("A %s is in progress, use %s --abort\n", command, command)
+		return
+	}
+	head := GetCommit(GetHead())
+	if head == nil {
+		fmt.Println("No commits yet")
+		return
+	}
+	ResetHard(head)
+	SaveConflicts(nil)
+	fmt.Printf("HEAD is now at %s %s\n", ShortHash(head.Hash), head.Subject())
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the working directory status",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		status := GetStatus()
+		if porcelain {
+			status.LogPorcelain()
+		} else {
+			status.Log()
+		}
+	},
+}
+
+var checkIgnoreCmd = &cobra.Command{
+	Use:   "check-ignore",
+	Short: "Show which ignore rule matches a path",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ignore := NewIgnore()
+		for _, p := range args {
+			info, err := os.Stat(p)
+			isDir := err == nil && info.IsDir()
+			rule := ignore.MatchWithParents(p, isDir)
+			if rule == nil || (rule.Negate && !verbose) {
+				continue
+			}
+			if verbose {
+				fmt.Printf("%s:%d:%s\t%s\n", rule.Source, rule.Line, rule.Text, p)
+			} else {
+				fmt.Println(p)
+			}
+		}
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [<commit> [<commit>] | <commit>..<commit> | <commit>...<commit>]",
+	Short: "Show changes between the working directory, commits and branches",
+	Args:  cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var commits []*Commit
+		if len(args) == 1 && strings.Contains(args[0], "..") {
+			// a..b is the diff of a and b, a...b the one of their merge base and b
+			include, exclude, ok := ResolveRange(args[0])
+			if !ok {
+				return
+			}
+			if strings.Contains(args[0], "...") {
+				if len(exclude) == 0 {
+					fmt.Println("No common ancestor")
+					return
+				}
+				commits = []*Commit{exclude[0], include[1]}
+			} else {
+				commits = []*Commit{exclude[0], include[0]}
+			}
+		}
+		for _, arg := range args {
+			if len(commits) != 0 {
+				break
+			}
+			commit := ResolveCommit(arg)
+			if commit == nil {
+				return
+			}
+			commits = append(commits, commit)
+		}
+		alg, ok := diff.Algorithms[algorithm]
+		if !ok {
+			fmt.Println("Unknown diff algorithm: " + algorithm)
+			return
+		}
+		DiffAlgorithm = alg
+		var diffs []FileDiff
+		if len(commits) == 2 {
+			diffs = DiffCommits(commits[0], commits[1])
+		} else if len(commits) == 1 {
+			diffs = DiffWorkingTree(commits[0])
+		} else {
+			diffs = DiffWorkingTree(GetCommit(GetHead()))
+		}
+		if diffStat {
+			LogDiffStat(diffs)
+		} else {
+			LogDiffs(diffs, unified)
+		}
+	},
+}
+
 var checkoutCmd = &cobra.Command{
 	Use:   "checkout",
 	Short: "Checkout a commit",
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		commitHash := args[0]
-		commit := GetCommit(commitHash)
+		if checkoutOurs && checkoutTheirs {
+			fmt.Println("--ours and --theirs can't be used together")
+			return
+		}
+		if checkoutOurs || checkoutTheirs {
+			CheckoutConflicts(args, checkoutOurs)
+			return
+		}
+		commit := ResolveCommit(args[0])
 		if commit != nil {
-			ApplyCommit(commit)
-			SaveHead(commit)
-		} else {
-			fmt.Println("Commit not found")
+			switchTo(commit, func() {
+				DetachHead(commit)
+			})
 		}
 	},
 }
@@ -75,22 +276,165 @@ var checkoutBranchCmd = &cobra.Command{
 		commitHash := GetBranchCommit(branchName)
 		if commitHash != "" {
 			commit := GetCommit(commitHash)
-			ApplyCommit(commit)
-			SaveHead(commit)
-			SaveHeadBranch(branchName)
+			switchTo(commit, func() {
+				SaveHeadBranch(branchName)
+			})
 		} else {
 			fmt.Println("Branch not found")
 		}
 	},
 }
 
+// switchTo checks out the commit and runs done to move HEAD. Uncommitted
+// changes and untracked files in the way would be lost when switching, so it
+// refuses to do it unless --force is given. With --autostash uncommitted
+// changes are stashed before and applied after. Leaving a detached HEAD warns
+// about the commits no branch points to anymore
+func switchTo(c *Commit, done func()) {
+	if checkInProgress() {
+		return
+	}
+	if paths := UntrackedOverwritten(c); len(paths) != 0 && !force {
+		fmt.Println("The following untracked files would be overwritten by checkout:")
+		for _, relativePath := range paths {
+			fmt.Printf("\t%s\n", relativePath)
+		}
+		fmt.Println("Move or remove them before switching, or use --force")
+		return
+	}
+	stashed := false
+	if status := GetStatus(); len(status.Staged) != 0 || len(status.Unstaged) != 0 {
+		switch {
+		case force:
+			if head := GetCommit(GetHead()); head != nil {
+				ResetHard(head)
+			}
+		case autostash:
+			stashed = StashPush("autostash", false)
+		default:
+			fmt.Println("Your local changes would be overwritten, commit or stash them, or use --force or --autostash")
+			return
+		}
+	}
+	oldHead := GetCommit(GetHead())
+	detached := GetHeadBranch() == ""
+	ApplyCommit(c)
+	done()
+	if detached && oldHead != nil {
+		WarnUnreferenced(oldHead)
+	}
+	if stashed {
+		fmt.Println("Applying the autostash")
+		StashApply(0, true)
+	}
+}
+
+var stashCmd = &cobra.Command{
+	Use:   "stash",
+	Short: "Save uncommitted changes and restore them later",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		stashPushCmd.Run(cmd, args)
+	},
+}
+
+var stashPushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Save the changes in a new stash entry and reset the files to HEAD",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if checkInProgress() {
+			return
+		}
+		StashPush(stashMessage, stashUntracked)
+	},
+}
+
+var stashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the stash entries",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		LogStash()
+	},
+}
+
+var stashShowCmd = &cobra.Command{
+	Use:   "show [stash]",
+	Short: "Show the changes of a stash entry",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if n := ParseStashRef(strings.Join(args, "")); n != -1 {
+			StashShow(n, stashPatch)
+		}
+	},
+}
+
+var stashApplyCmd = &cobra.Command{
+	Use:   "apply [stash]",
+	Short: "Apply the changes of a stash entry",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runStashApply(args, false)
+	},
+}
+
+var stashPopCmd = &cobra.Command{
+	Use:   "pop [stash]",
+	Short: "Apply the changes of a stash entry and drop it",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runStashApply(args, true)
+	},
+}
+
+func runStashApply(args []string, pop bool) {
+	if checkInProgress() || !checkCleanWorkingTree("apply a stash") {
+		return
+	}
+	if n := ParseStashRef(strings.Join(args, "")); n != -1 {
+		StashApply(n, pop)
+	}
+}
+
+var stashDropCmd = &cobra.Command{
+	Use:   "drop [stash]",
+	Short: "Remove a stash entry",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if n := ParseStashRef(strings.Join(args, "")); n != -1 {
+			StashDrop(n)
+		}
+	},
+}
+
 var logCmd = &cobra.Command{
-	Use:   "log",
+	Use:   "log [<commit> | <commit>..<commit> | <commit>...<commit>]",
 	Short: "Show commit logs",
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		commitHash := GetHead()
+		queue := []string{GetHead()}
 		vis := make(map[string]bool)
-		queue := []string{commitHash}
+		if len(args) == 1 {
+			include, exclude, ok := ResolveRange(args[0])
+			if !ok {
+				return
+			}
+			if tag := GetTag(args[0]); tag != nil && tag.Hash != "" {
+				tag.LogTag()
+			}
+			queue = nil
+			for _, commit := range include {
+				queue = append(queue, commit.Hash)
+			}
+			// commits before the excluded ones are marked as already shown
+			for _, commit := range exclude {
+				for hash := range Ancestors(commit) {
+					vis[hash] = true
+				}
+			}
+		}
+		refs := RefNames()
 		for len(queue) != 0 {
 			commitHash := queue[0]
 			queue = queue[1:]
@@ -98,11 +442,14 @@ var logCmd = &cobra.Command{
 			if commit == nil {
 				continue
 			}
-			_, ok := vis[commitHash]
-			if !ok {
-				commit.LogCommit()
-				vis[commitHash] = true
+			if vis[commitHash] {
+				continue
 			}
+			commit.LogCommitWithRefs(refs[commitHash])
+			if logPatch {
+				LogCommitDiff(commit)
+			}
+			vis[commitHash] = true
 			for _, prevCommit := range commit.PrevCommits {
 				queue = append(queue, prevCommit.Hash)
 			}
@@ -115,9 +462,9 @@ var beforeCmd = &cobra.Command{
 	Short: "Show commit logs before some time",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		timestamp, err := strconv.ParseInt(args[0], 10, 64)
-		if err != nil {
-			fmt.Println("Invalid timestamp")
+		timestamp, ok := ParseTime(args[0])
+		if !ok {
+			fmt.Println("Invalid time")
 			return
 		}
 		commitHash := GetHead()
@@ -169,40 +516,254 @@ var searchCommitCmd = &cobra.Command{
 var mergeCommitsCmd = &cobra.Command{
 	Use:   "merge",
 	Short: "Merges two commits",
-	Args:  cobra.ExactArgs(2),
+	Args: func(cmd *cobra.Command, args []string) error {
+		if mergeContinue || mergeAbort {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		commit1 := GetCommit(args[0])
-		commit2 := GetCommit(args[1])
+		if handleMergeFlags() {
+			return
+		}
+		commit1 := ResolveCommit(args[0])
+		commit2 := ResolveCommit(args[1])
 		if commit1 == nil || commit2 == nil {
-			fmt.Println("Commit not found")
 			return
 		}
-		Merge("user", commit1, commit2, true)
+		options, ok := getMergeOptions()
+		if !ok || !checkCleanWorkingTree("merge") {
+			return
+		}
+		StartMerge(commit1, commit2, args[0], args[1], false, options)
 	},
 }
 
 var mergeBranchesCmd = &cobra.Command{
 	Use:   "mb",
 	Short: "Merges two branches",
-	Args:  cobra.ExactArgs(1),
+	Args: func(cmd *cobra.Command, args []string) error {
+		if mergeContinue || mergeAbort {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		branch1 := GetBranchCommit(args[0])
-		branch2 := GetBranchCommit(GetHeadBranch())
-		if branch1 == "" || branch2 == "" || branch1 == branch2 {
+		if handleMergeFlags() {
+			return
+		}
+		if noFF && ffOnly {
+			fmt.Println("--no-ff and --ff-only can't be used together")
+			return
+		}
+		options, ok := getMergeOptions()
+		if !ok || !checkCleanWorkingTree("merge") {
+			return
+		}
+		commit1 := ResolveCommit(args[0])
+		if commit1 == nil {
+			return
+		}
+		commit2 := GetCommit(GetHead())
+		if commit2 == nil {
 			fmt.Println("Merge not possible")
 			return
 		}
-		commit1 := GetCommit(branch1)
-		commit2 := GetCommit(branch2)
-		Merge("user", commit1, commit2, true)
-		newCommit := CreateCommit("user", "Merge "+args[0]+" into "+GetHeadBranch(), []*Commit{commit1, commit2})
-		if newCommit != nil {
-			commits := *GetAllCommits()
-			commits = append(commits, *newCommit)
-			SaveHead(newCommit)
-			UpdateHeadBranch(newCommit.Hash)
-			SaveConfig(&commits)
+		// a detached HEAD is merged into like a branch
+		headName := GetHeadBranch()
+		if headName == "" {
+			headName = "HEAD"
 		}
+		MergeBranch(commit1, commit2, args[0], headName, noFF, ffOnly, options)
+	},
+}
+
+var mergeBaseCmd = &cobra.Command{
+	Use:   "merge-base <commit> <commit>",
+	Short: "Show the best common ancestors of two commits",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		commit1 := ResolveCommit(args[0])
+		commit2 := ResolveCommit(args[1])
+		if commit1 == nil || commit2 == nil {
+			return
+		}
+		bases := MergeBases(commit1, commit2)
+		if len(bases) == 0 {
+			fmt.Println("No common ancestor")
+			return
+		}
+		if !mergeBaseAll {
+			bases = bases[:1]
+		}
+		for _, base := range bases {
+			fmt.Println(base.Hash)
+		}
+	},
+}
+
+// getMergeOptions reads the --strategy and --strategy-option flags
+func getMergeOptions() (MergeOptions, bool) {
+	options := MergeOptions{Strategy: strategy}
+	if strategy != StrategyRecursive && strategy != StrategyOurs {
+		fmt.Printf("Unknown merge strategy %s\n", strategy)
+		return options, false
+	}
+	switch strategyOpt {
+	case "":
+	case "ours":
+		options.Favor = diff.FavorOurs
+	case "theirs":
+		options.Favor = diff.FavorTheirs
+	default:
+		fmt.Printf("Unknown strategy option %s\n", strategyOpt)
+		return options, false
+	}
+	return options, true
+}
+
+// handleMergeFlags runs --continue and --abort and refuses to start a new
+// merge while one is in progress. It returns true if the command is done
+func handleMergeFlags() bool {
+	if mergeContinue {
+		ContinueMerge()
+		return true
+	}
+	if mergeAbort {
+		AbortMerge()
+		return true
+	}
+	return checkInProgress()
+}
+
+// checkInProgress tells how to finish the merge, rebase, cherry-pick or
+// revert in progress, if any, and returns true if there is one
+func checkInProgress() bool {
+	command := InProgress()
+	if command == "" {
+		return false
+	}
+	if command == "stash" {
+		fmt.Println("Applying a stash left conflicts, fix them and add the files, or use reset --hard to go back to HEAD")
+		LogConflicts()
+		return true
+	}
+	fmt.Printf("A %s is in progress, use %s --continue or %s --abort\n", command, command, command)
+	LogConflicts()
+	return true
+}
+
+// checkCleanWorkingTree returns true if there are no staged or unstaged
+// changes, or tells that they must be committed first
+func checkCleanWorkingTree(command string) bool {
+	if status := GetStatus(); len(status.Staged) != 0 || len(status.Unstaged) != 0 {
+		fmt.Printf("Cannot %s with uncommitted changes, commit them first\n", command)
+		return false
+	}
+	return true
+}
+
+var cherryPickCmd = &cobra.Command{
+	Use:   "cherry-pick <commit>...",
+	Short: "Apply the changes of commits on top of the current branch",
+	Args:  pickArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runPick(args, "pick")
+	},
+}
+
+var revertCmd = &cobra.Command{
+	Use:   "revert <commit>...",
+	Short: "Commit the inverse of the changes of commits",
+	Args:  pickArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runPick(args, "revert")
+	},
+}
+
+func pickArgs(cmd *cobra.Command, args []string) error {
+	if pickContinue || pickAbort {
+		return cobra.NoArgs(cmd, args)
+	}
+	return cobra.MinimumNArgs(1)(cmd, args)
+}
+
+// runPick runs cherry-pick and revert, action is "pick" or "revert"
+func runPick(args []string, action string) {
+	if pickContinue {
+		ContinuePick()
+		return
+	}
+	if pickAbort {
+		AbortPick()
+		return
+	}
+	command := "cherry-pick"
+	if action == "revert" {
+		command = "revert"
+	}
+	if checkInProgress() || !checkCleanWorkingTree(command) {
+		return
+	}
+	if GetCommit(GetHead()) == nil {
+		fmt.Println("No commits yet")
+		return
+	}
+	var commits []*Commit
+	for _, arg := range args {
+		include, exclude, ok := ResolveRange(arg)
+		if !ok {
+			return
+		}
+		picked := include
+		if strings.Contains(arg, "..") {
+			picked = RangeCommits(include, exclude)
+		}
+		if len(picked) > 1 && action == "revert" {
+			// the newest commits of a range are reverted first
+			for i, j := 0, len(picked)-1; i < j; i, j = i+1, j-1 {
+				picked[i], picked[j] = picked[j], picked[i]
+			}
+		}
+		commits = append(commits, picked...)
+	}
+	if len(commits) == 0 {
+		fmt.Println("No commits to " + command)
+		return
+	}
+	StartPick(commits, action)
+}
+
+var rebaseCmd = &cobra.Command{
+	Use:   "rebase <upstream>",
+	Short: "Replay the commits of the current branch on top of another one",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if rebaseContinue || rebaseSkip || rebaseAbort {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if rebaseContinue {
+			ContinueRebase()
+			return
+		}
+		if rebaseSkip {
+			SkipRebase()
+			return
+		}
+		if rebaseAbort {
+			AbortRebase()
+			return
+		}
+		if checkInProgress() || !checkCleanWorkingTree("rebase") {
+			return
+		}
+		upstream := ResolveCommit(args[0])
+		if upstream == nil {
+			return
+		}
+		StartRebase(upstream, interactive)
 	},
 }
 
@@ -217,15 +778,28 @@ var branchCmd = &cobra.Command{
 		if len(args) > 1 {
 			branchName = args[1]
 		}
+		newName := branchName
+		if flag == "rename" && len(args) > 2 {
+			newName = args[2]
+		}
+		if (flag == "create" || flag == "rename") && !ValidRefName(newName) {
+			fmt.Printf("Invalid branch name %q\n", newName)
+			return
+		}
 		if flag == "create" {
 			var commitHash string
 			if len(args) != 3 {
 				commitHash = GetHead()
+			} else if commit := ResolveCommit(args[2]); commit != nil {
+				commitHash = commit.Hash
 			} else {
-				commitHash = args[2]
+				return
 			}
 			CreateBranch(branchName, commitHash)
-			SaveHeadBranch(branchName)
+			// HEAD only moves to the new branch if it is created at HEAD
+			if commitHash == GetHead() {
+				SaveHeadBranch(branchName)
+			}
 		} else if flag == "delete" {
 			DeleteBranch(branchName)
 		} else if flag == "rename" {
@@ -238,6 +812,52 @@ var branchCmd = &cobra.Command{
 	},
 }
 
+var tagCmd = &cobra.Command{
+	Use:   "tag [<name> [<commit>]]",
+	Short: "Create, list or delete tags",
+	Run: func(cmd *cobra.Command, args []string) {
+		if tagDelete {
+			if len(args) == 0 {
+				fmt.Println("No tag to delete")
+			}
+			for _, name := range args {
+				DeleteTag(name)
+			}
+			return
+		}
+		if len(args) == 0 {
+			if tagSubjects {
+				LogTagsWithSubjects()
+			} else {
+				LogTags()
+			}
+			return
+		}
+		if len(args) > 2 {
+			fmt.Println("Too many arguments")
+			return
+		}
+		rev := "HEAD"
+		if len(args) == 2 {
+			rev = args[1]
+		}
+		commit := ResolveCommit(rev)
+		if commit == nil {
+			return
+		}
+		message := tagMessage
+		if tagAnnotate && message == "" {
+			edited, ok := EditFile(".gogit/TAG_EDITMSG", "\n", []string{"Write a message for tag " + args[0] + ", lines starting with '#' are ignored."})
+			if !ok || edited == "" {
+				fmt.Println("Empty tag message, aborting")
+				return
+			}
+			message = edited
+		}
+		CreateTag(args[0], commit, "user", message, time.Now().Unix())
+	},
+}
+
 var gcCmd = &cobra.Command{
 	Use:   "gc",
 	Short: "Garbage collection",
@@ -246,6 +866,12 @@ var gcCmd = &cobra.Command{
 		commits := *GetAllCommits()
 		queue := []string{}
 		queue = append(queue, *GetAllBranchHeads()...)
+		queue = append(queue, GetStash()...)
+		// a detached HEAD and the tags keep their commits
+		queue = append(queue, GetHead())
+		for _, tag := range GetAllTags() {
+			queue = append(queue, tag.Target)
+		}
 		for len(queue) != 0 {
 			commitHash := queue[0]
 			queue = queue[1:]
@@ -285,19 +911,11 @@ var fileHistoryCmd = &cobra.Command{
 		for len(queue) != 0 {
 			commit := queue[0]
 			queue = queue[1:]
-			hasModifiedFile := false
-			for _, object := range commit.Objects {
-				if object.RelativePath == relativeFilePath {
-					hasModifiedFile = true
-					for _, prevCommit := range commit.PrevCommits {
-						for _, prevObject := range prevCommit.Objects {
-							if prevObject.RelativePath == relativeFilePath {
-								if object.Hash == prevObject.Hash {
-									hasModifiedFile = false
-								}
-							}
-						}
-					}
+			hash := GetTreeObject(commit.Tree, relativeFilePath)
+			hasModifiedFile := hash != ""
+			for _, prevCommit := range commit.PrevCommits {
+				if prevCommit.Tree == commit.Tree || GetTreeObject(prevCommit.Tree, relativeFilePath) == hash {
+					hasModifiedFile = false
 				}
 			}
 
@@ -331,7 +949,7 @@ var moveAcrossCommitsCmd = &cobra.Command{
 					currCommit = currCommit.PrevCommits[0]
 					fmt.Println("\nCurrent commit: ")
 					ApplyCommit(currCommit)
-					SaveHead(currCommit)
+					DetachHead(currCommit)
 					currCommit.LogCommit()
 				}
 			} else if char == "r\n" {
@@ -352,7 +970,7 @@ var moveAcrossCommitsCmd = &cobra.Command{
 					fmt.Println("\nCurrent commit: ")
 					currCommit.LogCommit()
 					ApplyCommit(currCommit)
-					SaveHead(currCommit)
+					DetachHead(currCommit)
 				} else {
 					fmt.Println("No next commits")
 				}
@@ -363,6 +981,31 @@ var moveAcrossCommitsCmd = &cobra.Command{
 	},
 }
 
+var migrateObjectsCmd = &cobra.Command{
+	Use:   "migrate-objects",
+	Short: "Convert commits and objects stored in the old formats",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commits := MigrateCommits()
+		count := MigrateObjects()
+		fmt.Printf("Migrated %d commits and %d objects\n", commits, count)
+	},
+}
+
+var repackCmd = &cobra.Command{
+	Use:   "repack",
+	Short: "Pack loose objects with delta compression",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		count, deltas := Repack(repackAll)
+		if count == 0 {
+			fmt.Println("Nothing to pack")
+			return
+		}
+		fmt.Printf("Packed %d objects (%d deltas)\n", count, deltas)
+	},
+}
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
@@ -371,13 +1014,57 @@ func Execute() {
 }
 
 func init() {
-	Initialize()
-
 	searchCommitCmd.Flags().BoolVarP(&lev, "lev", "l", false, "Use Levenshtein distance to search for commit")
 	searchCommitCmd.Flags().BoolVarP(&cos, "cos", "c", false, "Use Cosine Sim distance to search for commit")
 	searchCommitCmd.Flags().BoolVarP(&jac, "jac", "j", false, "Use Jaccard distance to search for commit")
 	searchCommitCmd.Flags().BoolVarP(&lcs, "lcs", "", false, "Use Longest Common Subsequence distance to search for commit")
 
+	repackCmd.Flags().BoolVarP(&repackAll, "all", "a", false, "Also repack the objects of existing packs into a single pack")
+
+	commitCmd.Flags().BoolVarP(&commitAll, "all", "a", false, "Stage the changes of tracked files before committing")
+	rmCmd.Flags().BoolVarP(&rmCached, "cached", "", false, "Only remove the files from the staging area")
+	resetCmd.Flags().BoolVarP(&resetHard, "hard", "", false, "Discard the uncommitted changes to tracked files and the conflicts of a stash")
+	statusCmd.Flags().BoolVarP(&porcelain, "porcelain", "", false, "Machine-readable output")
+	checkIgnoreCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show the matching rule")
+	diffCmd.Flags().IntVarP(&unified, "unified", "U", 3, "Number of context lines")
+	diffCmd.Flags().BoolVarP(&diffStat, "stat", "", false, "Only show the number of changed lines per file")
+	diffCmd.Flags().StringVarP(&algorithm, "diff-algorithm", "", "histogram", "Diff algorithm (myers, histogram or patience)")
+
+	for _, cmd := range []*cobra.Command{mergeCommitsCmd, mergeBranchesCmd} {
+		cmd.Flags().BoolVarP(&mergeContinue, "continue", "", false, "Create the merge commit after resolving the conflicts")
+		cmd.Flags().BoolVarP(&mergeAbort, "abort", "", false, "Abort the merge and restore the files from before it")
+		cmd.Flags().StringVarP(&strategy, "strategy", "s", StrategyRecursive, "Merge strategy (recursive or ours)")
+		cmd.Flags().StringVarP(&strategyOpt, "strategy-option", "X", "", "Take our or their side of conflicting changes (ours or theirs)")
+	}
+	mergeBranchesCmd.Flags().BoolVarP(&noFF, "no-ff", "", false, "Create a merge commit even when the branch can be fast-forwarded")
+	mergeBranchesCmd.Flags().BoolVarP(&ffOnly, "ff-only", "", false, "Refuse to merge unless the branch can be fast-forwarded")
+	for _, cmd := range []*cobra.Command{cherryPickCmd, revertCmd} {
+		cmd.Flags().BoolVarP(&pickContinue, "continue", "", false, "Commit the resolved conflicts and apply the remaining commits")
+		cmd.Flags().BoolVarP(&pickAbort, "abort", "", false, "Abort and restore the branch from before the first commit")
+	}
+	rebaseCmd.Flags().BoolVarP(&rebaseContinue, "continue", "", false, "Commit the resolved conflicts and replay the remaining commits")
+	rebaseCmd.Flags().BoolVarP(&rebaseSkip, "skip", "", false, "Drop the commit with conflicts and replay the remaining commits")
+	rebaseCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Edit the list of commits to replay")
+	rebaseCmd.Flags().BoolVarP(&rebaseAbort, "abort", "", false, "Abort the rebase and restore the branch")
+	logCmd.Flags().BoolVarP(&logPatch, "patch", "p", false, "Show the changes of each commit")
+	for _, cmd := range []*cobra.Command{checkoutCmd, checkoutBranchCmd} {
+		cmd.Flags().BoolVarP(&force, "force", "f", false, "Discard the uncommitted changes")
+		cmd.Flags().BoolVarP(&autostash, "autostash", "", false, "Stash the uncommitted changes and apply them after switching")
+	}
+	for _, cmd := range []*cobra.Command{stashCmd, stashPushCmd} {
+		cmd.Flags().StringVarP(&stashMessage, "message", "m", "", "Description of the stash entry")
+		cmd.Flags().BoolVarP(&stashUntracked, "include-untracked", "u", false, "Also stash the untracked files")
+	}
+	stashShowCmd.Flags().BoolVarP(&stashPatch, "patch", "p", false, "Show the changes instead of the number of changed lines")
+	stashCmd.AddCommand(stashPushCmd, stashListCmd, stashShowCmd, stashApplyCmd, stashPopCmd, stashDropCmd)
+	checkoutCmd.Flags().BoolVarP(&checkoutOurs, "ours", "", false, "Restore our version of conflicted paths")
+	checkoutCmd.Flags().BoolVarP(&checkoutTheirs, "theirs", "", false, "Restore their version of conflicted paths")
+	mergeBaseCmd.Flags().BoolVarP(&mergeBaseAll, "all", "a", false, "Show all the best common ancestors")
+	tagCmd.Flags().BoolVarP(&tagAnnotate, "annotate", "a", false, "Make an annotated tag, the message is edited unless given with -m")
+	tagCmd.Flags().StringVarP(&tagMessage, "message", "m", "", "Message of an annotated tag")
+	tagCmd.Flags().BoolVarP(&tagDelete, "delete", "d", false, "Delete the tags")
+	tagCmd.Flags().BoolVarP(&tagSubjects, "subjects", "n", false, "List the tags with the first line of their message")
+
 	rootCmd.AddCommand(commitCmd)
 	rootCmd.AddCommand(checkoutCmd)
 	rootCmd.AddCommand(checkoutBranchCmd)
@@ -387,7 +1074,21 @@ func init() {
 	rootCmd.AddCommand(mergeCommitsCmd)
 	rootCmd.AddCommand(branchCmd)
 	rootCmd.AddCommand(mergeBranchesCmd)
+	rootCmd.AddCommand(mergeBaseCmd)
+	rootCmd.AddCommand(rebaseCmd)
+	rootCmd.AddCommand(cherryPickCmd)
+	rootCmd.AddCommand(revertCmd)
+	rootCmd.AddCommand(stashCmd)
+	rootCmd.AddCommand(tagCmd)
 	rootCmd.AddCommand(gcCmd)
 	rootCmd.AddCommand(fileHistoryCmd)
 	rootCmd.AddCommand(moveAcrossCommitsCmd)
+	rootCmd.AddCommand(migrateObjectsCmd)
+	rootCmd.AddCommand(repackCmd)
+	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(rmCmd)
+	rootCmd.AddCommand(resetCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(checkIgnoreCmd)
+	rootCmd.AddCommand(diffCmd)
 }
@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"io/ioutil"
 	"os"
-	"path/filepath"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -12,7 +14,7 @@ import (
 type Commit struct {
 	User        string    // User who made the commit
 	Hash        string    // Hash of the commit
-	Objects     []Object  // Objects (files) that were changed
+	Tree        string    // Hash of the root tree
 	PrevCommits []*Commit // Previous commit
 	Time        int64     // Time of the commit
 	Message     string    // Message of the commit
@@ -24,26 +26,111 @@ func (c *Commit) Serialize() string {
 		prevCommitHashes = append(prevCommitHashes, commit.Hash)
 	}
 	prevCommitHashConcat := strings.Join(prevCommitHashes, ",")
-	var objectsString string
-	for _, object := range c.Objects {
-		objectsString += object.Serialize() + ","
-	}
-	return fmt.Sprintf("%s\n%s\n%d\n%s\n%s\n%d\n%s", c.User, c.Hash, len(c.Objects), objectsString, prevCommitHashConcat, c.Time, c.Message)
+	return fmt.Sprintf("%s\n%s\n%s\n%s\n%d\n%s", c.User, c.Hash, c.Tree, prevCommitHashConcat, c.Time, c.Message)
 }
 
 func DeserializeCommit(s string) *Commit {
-	var user, hash, prevCommitHashConcat string
-	var objectCount int
-	var objectsString string
-	fmt.Sscanf(s, "%s\n%s\n%d\n%s\n%s\n", &user, &hash, &objectCount, &objectsString, &prevCommitHashConcat)
-	message := GetMessageFromCommitFile(hash)
-	time := GetTimeFromCommitFile(hash)
-	objects := strings.Split(objectsString, ",")
-	var objectsList []Object
-	for i := 0; i < objectCount; i++ {
-		objectsList = append(objectsList, *DeserializeObject(objects[i]))
+	if IsLegacyCommit(s) {
+		return deserializeLegacyCommit(s)
+	}
+	lines := strings.SplitN(strings.TrimSuffix(s, "\n"), "\n", 6)
+	if len(lines) < 6 {
+		panic("Invalid commit")
+	}
+	time, err := strconv.ParseInt(lines[4], 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return &Commit{lines[0], lines[1], lines[2], GetMultipleCommits(lines[3]), time, lines[5]}
+}
+
+// IsLegacyCommit returns true for commits from before trees, which list their
+// files instead of a tree:
+//
+//	<user>
+//	<hash>
+//	<number of files>
+//	<blob hash>|<path>,<blob hash>|<path>,...
+//	<parent hashes>
+//	<time>
+//	<message>
+func IsLegacyCommit(s string) bool {
+	lines := strings.SplitN(s, "\n", 4)
+	if len(lines) < 4 {
+		return false
+	}
+	// a tree hash is too long to parse as a count
+	_, err := strconv.Atoi(lines[2])
+	return err == nil
+}
+
+// deserializeLegacyCommit reads a commit from before trees, the tree of its
+// files is built from the blobs it lists
+func deserializeLegacyCommit(s string) *Commit {
+	lines := strings.SplitN(strings.TrimSuffix(s, "\n"), "\n", 7)
+	if len(lines) < 7 {
+		panic("Invalid commit")
+	}
+	count, err := strconv.Atoi(lines[2])
+	if err != nil {
+		panic(err)
+	}
+	var objects []Object
+	for i, field := range strings.Split(lines[3], ",") {
+		if i == count {
+			break
+		}
+		objects = append(objects, *DeserializeObject(field))
+	}
+	time, err := strconv.ParseInt(lines[5], 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return &Commit{lines[0], lines[1], BuildTree(objects), GetMultipleCommits(lines[4]), time, lines[6]}
+}
+
+// MigrateCommits rewrites the commits from before trees with the current
+// format and returns how many were rewritten. Their hashes don't change
+func MigrateCommits() int {
+	files, err := os.ReadDir(".gogit/commits")
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		panic(err)
+	}
+	count := 0
+	for _, file := range files {
+		path := ".gogit/commits/" + file.Name()
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+		if !IsLegacyCommit(string(b)) {
+			continue
+		}
+		c := DeserializeCommit(string(b))
+		err = ioutil.WriteFile(path+".tmp", []byte(c.Serialize()+"\n"), 0644)
+		if err != nil {
+			panic(err)
+		}
+		err = os.Rename(path+".tmp", path)
+		if err != nil {
+			panic(err)
+		}
+		count++
 	}
-	return &Commit{user, hash, objectsList, GetMultipleCommits(prevCommitHashConcat), time, message}
+	return count
+}
+
+// Subject returns the first line of the commit message
+func (c *Commit) Subject() string {
+	return strings.SplitN(c.Message, "\n", 2)[0]
+}
+
+// GetObjects returns all the files in the commit's tree
+func (c *Commit) GetObjects() []Object {
+	return FlattenTree(c.Tree, "")
 }
 
 func GetMultipleCommits(hashesConcat string) []*Commit {
@@ -88,71 +175,110 @@ func SaveCommit(c *Commit) {
 }
 
 func GetSnapshot() []Object {
+	return SnapshotPath(".", TrackedPaths(GetIndex()))
+}
+
+// SnapshotPath stores every file under root that is tracked or not ignored
+// and returns them as objects. Root and the tracked paths that are
+// directories without files in them are returned as kept empty directories
+func SnapshotPath(root string, tracked map[string]bool) []Object {
+	return snapshot(root, tracked, false)
+}
+
+// SnapshotTracked is SnapshotPath of the whole working directory without the
+// untracked files, which aren't stored
+func SnapshotTracked(tracked map[string]bool) []Object {
+	return snapshot(".", tracked, true)
+}
+
+func snapshot(root string, tracked map[string]bool, onlyTracked bool) []Object {
 	var objects []Object
-	err := filepath.Walk(".",
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if info.IsDir() && info.Name() == ".gogit" {
-				return filepath.SkipDir
-			}
-			if !info.IsDir() {
-				f, err := os.OpenFile(path, os.O_RDONLY, 0644)
-				if err != nil {
-					panic(err)
-				}
-				defer f.Close()
-				hash := HashFile(f)
-				CopyFile(path, ".gogit/objects/"+hash)
-				objects = append(objects, Object{hash, path})
-			}
-			return nil
-		})
-	if err != nil {
-		log.Println(err)
+	WalkWorkingTree(root, tracked, func(relativePath string, info os.FileInfo) {
+		if onlyTracked && !tracked[relativePath] {
+			return
+		}
+		hash := WriteBlobFromFile(relativePath)
+		objects = append(objects, Object{hash, relativePath, FileModeOf(info)})
+	})
+	candidates := map[string]bool{}
+	if root != "." {
+		candidates[root] = true
+	}
+	for relativePath := range tracked {
+		if IsUnderPath(relativePath, root) {
+			candidates[relativePath] = true
+		}
+	}
+	var paths []string
+	for _, object := range objects {
+		paths = append(paths, object.RelativePath)
+	}
+	for _, dir := range KeptDirs(candidates, paths) {
+		objects = append(objects, Object{SaveTree(&Tree{}), dir, DirMode})
 	}
 	return objects
 }
 
-func HashObjects(objects []Object, time int64) string {
-	var hash string
-	for _, object := range objects {
-		hash += object.Hash
+// KeptDirs returns the paths among candidates that are directories in the
+// working directory and don't contain any of the files
+func KeptDirs(candidates map[string]bool, files []string) []string {
+	var dirs []string
+	for dir := range candidates {
+		info, err := os.Lstat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		empty := true
+		for _, relativePath := range files {
+			if IsUnderPath(relativePath, dir) {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			dirs = append(dirs, dir)
+		}
 	}
-	return HashString(hash, time)
+	return dirs
+}
+
+func HashCommit(tree string, parentCommits []*Commit, message string, time int64) string {
+	hash := tree
+	for _, commit := range parentCommits {
+		hash += commit.Hash
+	}
+	return HashString(hash+message, time)
 }
 
 func CreateCommit(user string, message string, parentCommits []*Commit) *Commit {
-	objects := GetSnapshot()
+	return CreateCommitAt(user, message, parentCommits, time.Now().Unix())
+}
 
-	//check if the commit is the same as the previous one
-	if len(parentCommits) == 1 {
-		same := true
-		currSnap := map[string]string{} // relative path -> hash
-		for _, object := range objects {
-			currSnap[object.RelativePath] = object.Hash
-		}
-		if len(objects) != len(parentCommits[0].Objects) {
-			same = false
-		}
-		for _, object := range parentCommits[0].Objects {
-			if currSnap[object.RelativePath] != object.Hash {
-				same = false
-			}
-		}
-		if same {
-			fmt.Println("Nothing to commit")
-			return nil
-		}
+// CreateCommitAt is CreateCommit with the time of the commit given, which is
+// used to keep the time of replayed commits
+func CreateCommitAt(user string, message string, parentCommits []*Commit, currTime int64) *Commit {
+	if HasConflicts() {
+		fmt.Println("Cannot commit with unresolved conflicts in:")
+		LogConflicts()
+		return nil
+	}
+	index := GetIndex()
+	if len(parentCommits) == 0 && len(index) == 0 {
+		fmt.Println("Nothing to commit, add files to the staging area first")
+		return nil
 	}
+	tree := BuildTree(IndexObjects(index))
 
-	currTime := time.Now().Unix()
+	//check if the commit is the same as the previous one
+	if len(parentCommits) == 1 && parentCommits[0].Tree == tree {
+		fmt.Println("Nothing to commit")
+		return nil
+	}
 
 	commit := Commit{
 		User:        user,
-		Hash:        HashObjects(objects, currTime),
-		Objects:     objects,
+		Hash:        HashCommit(tree, parentCommits, message, currTime),
+		Tree:        tree,
 		PrevCommits: parentCommits,
 		Time:        currTime,
 		Message:     message,
@@ -161,32 +287,153 @@ func CreateCommit(user string, message string, parentCommits []*Commit) *Commit
 	return &commit
 }
 
+// ApplyCommit updates the working directory and the index from HEAD to the
+// commit. Only the files that differ between the two trees are written or
+// removed, untracked and ignored files are kept
 func ApplyCommit(c *Commit) {
-	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+	headTree := ""
+	if head := GetCommit(GetHead()); head != nil {
+		headTree = head.Tree
+	}
+	WriteChanges(DiffTrees(headTree, c.Tree))
+	index := map[string]Object{}
+	for _, object := range c.GetObjects() {
+		index[object.RelativePath] = object
+	}
+	SaveIndex(index)
+}
+
+// UntrackedOverwritten returns the untracked files of the working directory
+// that checking out the commit would overwrite
+func UntrackedOverwritten(c *Commit) []string {
+	headTree := ""
+	if head := GetCommit(GetHead()); head != nil {
+		headTree = head.Tree
+	}
+	index := GetIndex()
+	var paths []string
+	for _, change := range DiffTrees(headTree, c.Tree) {
+		if _, ok := index[change.Path]; ok || change.NewHash == "" {
+			continue
+		}
+		info, err := os.Lstat(change.Path)
 		if err != nil {
-			return err
+			continue
+		}
+		if info.IsDir() {
+			if change.NewMode != DirMode {
+				paths = append(paths, change.Path)
+			}
+			continue
 		}
-		if info.IsDir() && info.Name() == ".gogit" {
-			return filepath.SkipDir
+		if HashWorkingFile(change.Path) != change.NewHash {
+			paths = append(paths, change.Path)
 		}
-		if !info.IsDir() {
-			err = os.Remove(path)
-			if err != nil {
-				panic(err)
+	}
+	return paths
+}
+
+// UntrackedOverwrittenBy returns the untracked files of the working directory
+// that writing the objects (relative path -> hash) with their modes (relative
+// path -> mode) would overwrite
+func UntrackedOverwrittenBy(objects map[string]string, modes map[string]string) []string {
+	index := GetIndex()
+	var paths []string
+	for relativePath, hash := range objects {
+		if _, ok := index[relativePath]; ok {
+			continue
+		}
+		info, err := os.Lstat(relativePath)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			if ModeOf(modes, relativePath) != DirMode {
+				paths = append(paths, relativePath)
 			}
+			continue
 		}
-		return nil
-	})
-	if err != nil {
-		panic(err)
+		if HashWorkingFile(relativePath) != hash {
+			paths = append(paths, relativePath)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// CheckUntracked lists the untracked files that the command would overwrite
+// and returns false if there are some
+func CheckUntracked(paths []string, command string) bool {
+	if len(paths) == 0 {
+		return true
 	}
-	for _, object := range c.Objects {
-		CopyFile(".gogit/objects/"+object.Hash, object.RelativePath)
+	fmt.Printf("The following untracked files would be overwritten by the %s:\n", command)
+	for _, relativePath := range paths {
+		fmt.Printf("\t%s\n", relativePath)
 	}
+	fmt.Printf("Move or remove them before the %s\n", command)
+	return false
+}
+
+// WriteChanges applies the changes to the working directory. Removed files
+// are deleted first, along with the directories they leave empty, then the
+// added and modified files are written with their parent directories
+func WriteChanges(changes []Change) {
+	for _, change := range changes {
+		if change.NewHash == "" {
+			os.Remove(change.Path)
+			RemoveEmptyDirs(path.Dir(change.Path))
+		}
+	}
+	for _, change := range changes {
+		if change.NewHash == "" {
+			continue
+		}
+		if change.NewMode == DirMode {
+			os.MkdirAll(change.Path, 0755)
+			continue
+		}
+		WriteBlobWithMode(change.NewHash, change.Path, change.NewMode)
+	}
+}
+
+// RemoveEmptyDirs removes dir and then its parents until one isn't empty
+func RemoveEmptyDirs(dir string) {
+	for dir != "." && dir != "/" && os.Remove(dir) == nil {
+		dir = path.Dir(dir)
+	}
+}
+
+// RecordCommit adds a new commit to the history and moves HEAD, and the
+// branch it points to, to it
+func RecordCommit(c *Commit) {
+	commits := *GetAllCommits()
+	found := false
+	for _, commit := range commits {
+		if commit.Hash == c.Hash {
+			found = true
+		}
+	}
+	// a replayed commit can be the same as the original one
+	if !found {
+		commits = append(commits, *c)
+		SaveConfig(&commits)
+	}
+	SaveHead(c)
 }
 
 func (c *Commit) LogCommit() {
-	fmt.Printf("Commit: %s\n", c.Hash)
+	c.LogCommitWithRefs(nil)
+}
+
+// LogCommitWithRefs is LogCommit with the names of the refs pointing to the
+// commit after its hash
+func (c *Commit) LogCommitWithRefs(refs []string) {
+	if len(refs) != 0 {
+		fmt.Printf("Commit: %s (%s)\n", c.Hash, strings.Join(refs, ", "))
+	} else {
+		fmt.Printf("Commit: %s\n", c.Hash)
+	}
 	fmt.Printf("Author: %s\n", c.User)
 	fmt.Printf("Date: %s\n", time.Unix(c.Time, 0))
 	fmt.Printf("Message: %s\n\n", c.Message)
@@ -199,13 +446,3 @@ func (c *Commit) DeleteCommit() {
 	}
 	// TODO: delete objects
 }
-
-func GetHead() string {
-	head, err := os.OpenFile(".gogit/HEAD", os.O_RDONLY|os.O_CREATE, 0644)
-	if err != nil {
-		panic(err)
-	}
-	defer head.Close()
-	commitHash := FileToString(head)
-	return commitHash
-}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gogit/diff"
+)
+
+// DiffAlgorithm is used for every line diff
+var DiffAlgorithm = diff.Default
+
+type DiffLine struct {
+	Op   byte   // ' ' for context, '-' for deletions and '+' for additions
+	Text string // Line including its "\n" (missing on a last line without one)
+}
+
+type Hunk struct {
+	OldStart int // Line of the first old line (1-based)
+	OldLines int
+	NewStart int // Line of the first new line (1-based)
+	NewLines int
+	Lines    []DiffLine
+}
+
+// FileDiff is the difference of one file between two sides of a diff
+type FileDiff struct {
+	Path       string
+	OldHash    string // "" if the file was added
+	NewHash    string // "" if the file was deleted
+	OldMode    string // "" if the file was added
+	NewMode    string // "" if the file was deleted
+	OldContent []byte
+	NewContent []byte
+	Binary     bool // Whether one of the sides is binary
+}
+
+func SplitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// DiffLines returns the edit script turning a into b
+func DiffLines(a, b []string) []DiffLine {
+	var lines []DiffLine
+	for _, edit := range DiffAlgorithm(a, b) {
+		switch edit.Op {
+		case diff.Equal:
+			for _, line := range a[edit.A0:edit.A1] {
+				lines = append(lines, DiffLine{' ', line})
+			}
+		case diff.Delete:
+			for _, line := range a[edit.A0:edit.A1] {
+				lines = append(lines, DiffLine{'-', line})
+			}
+		case diff.Insert:
+			for _, line := range b[edit.B0:edit.B1] {
+				lines = append(lines, DiffLine{'+', line})
+			}
+		}
+	}
+	return lines
+}
+
+// Hunks groups the changes of an edit script with context lines around them
+func Hunks(lines []DiffLine, context int) []Hunk {
+	var hunks []Hunk
+	oldLine, newLine := 1, 1
+	start := -1 // index of the first line of the current hunk
+	lastChange := -1
+	var hunk Hunk
+	flush := func(end int) {
+		hunk.Lines = lines[start:end]
+		for _, line := range hunk.Lines {
+			if line.Op != '+' {
+				hunk.OldLines++
+			}
+			if line.Op != '-' {
+				hunk.NewLines++
+			}
+		}
+		// an empty side starts at the line before the hunk
+		if hunk.OldLines == 0 {
+			hunk.OldStart--
+		}
+		if hunk.NewLines == 0 {
+			hunk.NewStart--
+		}
+		hunks = append(hunks, hunk)
+		start = -1
+	}
+	for i, line := range lines {
+		if line.Op != ' ' {
+			if start != -1 && i-lastChange > 2*context+1 {
+				flush(lastChange + context + 1)
+			}
+			if start == -1 {
+				start = i - context
+				if start < 0 {
+					start = 0
+				}
+				hunk = Hunk{OldStart: oldLine - (i - start), NewStart: newLine - (i - start)}
+			}
+			lastChange = i
+		}
+		if line.Op != '+' {
+			oldLine++
+		}
+		if line.Op != '-' {
+			newLine++
+		}
+	}
+	if start != -1 {
+		end := lastChange + context + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+		flush(end)
+	}
+	return hunks
+}
+
+func (h *Hunk) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+	for _, line := range h.Lines {
+		sb.WriteByte(line.Op)
+		sb.WriteString(line.Text)
+		if !strings.HasSuffix(line.Text, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	return sb.String()
+}
+
+func (d *FileDiff) Unified(context int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "diff --gogit a/%s b/%s\n", d.Path, d.Path)
+	oldName, newName := "a/"+d.Path, "b/"+d.Path
+	if d.OldHash == "" {
+		fmt.Fprintf(&sb, "new file mode %s\n", d.NewMode)
+		oldName = "/dev/null"
+	} else if d.NewHash == "" {
+		fmt.Fprintf(&sb, "deleted file mode %s\n", d.OldMode)
+		newName = "/dev/null"
+	} else if d.OldMode != d.NewMode {
+		fmt.Fprintf(&sb, "old mode %s\nnew mode %s\n", d.OldMode, d.NewMode)
+	}
+	if d.OldHash == d.NewHash || d.OldMode == DirMode || d.NewMode == DirMode {
+		// only the mode changed or a kept empty directory has no content
+		return sb.String()
+	}
+	if d.Binary {
+		fmt.Fprintf(&sb, "Binary files %s and %s differ\n", oldName, newName)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	lines := DiffLines(SplitLines(string(d.OldContent)), SplitLines(string(d.NewContent)))
+	for _, hunk := range Hunks(lines, context) {
+		sb.WriteString(hunk.String())
+	}
+	return sb.String()
+}
+
+// Counts returns the number of added and deleted lines, which is 0 for binary
+// files
+func (d *FileDiff) Counts() (int, int) {
+	added, deleted := 0, 0
+	if d.Binary {
+		return 0, 0
+	}
+	for _, line := range DiffLines(SplitLines(string(d.OldContent)), SplitLines(string(d.NewContent))) {
+		if line.Op == '+' {
+			added++
+		} else if line.Op == '-' {
+			deleted++
+		}
+	}
+	return added, deleted
+}
+
+// DiffObjects compares two sets of files (relative path -> hash) with their
+// modes (relative path -> mode). Files of the new side are read from the
+// working directory if fromWorkingTree is set
+func DiffObjects(oldObjects, newObjects, oldModes, newModes map[string]string, fromWorkingTree bool) []FileDiff {
+	var diffs []FileDiff
+	attributes := GetAttributes()
+	for _, change := range DiffMaps(oldObjects, newObjects, oldModes, newModes) {
+		d := FileDiff{Path: change.Path, OldHash: change.OldHash, NewHash: change.NewHash, OldMode: change.OldMode, NewMode: change.NewMode}
+		if change.OldHash != "" {
+			d.OldContent = ReadBlob(change.OldHash)
+		}
+		if change.NewHash != "" && change.NewMode != DirMode {
+			if fromWorkingTree {
+				d.NewContent = ReadWorkingFile(change.Path)
+			} else {
+				d.NewContent = ReadBlob(change.NewHash)
+			}
+		}
+		d.Binary = attributes.IsBinary(d.Path, d.OldContent) || attributes.IsBinary(d.Path, d.NewContent)
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// DiffWorkingTree compares the commit with the tracked files of the working
+// directory
+func DiffWorkingTree(c *Commit) []FileDiff {
+	oldObjects := map[string]string{}
+	oldModes := map[string]string{}
+	if c != nil {
+		oldObjects = TreeToMap(c.Tree)
+		oldModes = TreeModes(c.Tree)
+	}
+	tracked := TrackedPaths(GetIndex())
+	for relativePath := range oldObjects {
+		tracked[relativePath] = true
+	}
+	newObjects := map[string]string{}
+	workingObjects, newModes := WorkingTreeObjects(tracked)
+	for relativePath, hash := range workingObjects {
+		if tracked[relativePath] {
+			newObjects[relativePath] = hash
+		}
+	}
+	return DiffObjects(oldObjects, newObjects, oldModes, newModes, true)
+}
+
+func DiffCommits(a, b *Commit) []FileDiff {
+	// only the changed files are needed
+	oldObjects := map[string]string{}
+	newObjects := map[string]string{}
+	oldModes := map[string]string{}
+	newModes := map[string]string{}
+	for _, change := range DiffTrees(a.Tree, b.Tree) {
+		if change.OldHash != "" {
+			oldObjects[change.Path] = change.OldHash
+			oldModes[change.Path] = change.OldMode
+		}
+		if change.NewHash != "" {
+			newObjects[change.Path] = change.NewHash
+			newModes[change.Path] = change.NewMode
+		}
+	}
+	return DiffObjects(oldObjects, newObjects, oldModes, newModes, false)
+}
+
+// LogCommitDiff prints the changes of a commit against its parent, merge
+// commits are skipped
+func LogCommitDiff(c *Commit) {
+	parent := &Commit{}
+	if len(c.PrevCommits) > 1 {
+		return
+	} else if len(c.PrevCommits) == 1 {
+		parent = c.PrevCommits[0]
+	}
+	LogDiffs(DiffCommits(parent, c), 3)
+	fmt.Println()
+}
+
+func LogDiffs(diffs []FileDiff, context int) {
+	for _, d := range diffs {
+		fmt.Print(d.Unified(context))
+	}
+}
+
+func LogDiffStat(diffs []FileDiff) {
+	const maxWidth = 50
+	width := 0
+	maxChanges := 0
+	counts := make([][2]int, len(diffs))
+	for i := range diffs {
+		added, deleted := diffs[i].Counts()
+		counts[i] = [2]int{added, deleted}
+		if len(diffs[i].Path) > width {
+			width = len(diffs[i].Path)
+		}
+		if added+deleted > maxChanges {
+			maxChanges = added + deleted
+		}
+	}
+	totalAdded, totalDeleted := 0, 0
+	for i, d := range diffs {
+		added, deleted := counts[i][0], counts[i][1]
+		totalAdded += added
+		totalDeleted += deleted
+		if maxChanges > maxWidth {
+			// scale the bars so the largest change fits
+			added = (added*maxWidth + maxChanges - 1) / maxChanges
+			deleted = (deleted*maxWidth + maxChanges - 1) / maxChanges
+		}
+		if d.Binary {
+			fmt.Printf(" %-*s | Bin %d -> %d bytes\n", width, d.Path, len(d.OldContent), len(d.NewContent))
+			continue
+		}
+		fmt.Printf(" %-*s | %d %s%s\n", width, d.Path, counts[i][0]+counts[i][1], strings.Repeat("+", added), strings.Repeat("-", deleted))
+	}
+	fmt.Printf(" %d files changed, %d insertions(+), %d deletions(-)\n", len(diffs), totalAdded, totalDeleted)
+}
@@ -0,0 +1,130 @@
+// Package diff computes line based edit scripts between two sequences of
+// lines with the Myers, histogram and patience algorithms.
+package diff
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Edit is a run of lines with the same operation. Equal runs have
+// A[A0:A1] == B[B0:B1], Delete runs remove A[A0:A1] and Insert runs add
+// B[B0:B1].
+type Edit struct {
+	Op     Op
+	A0, A1 int
+	B0, B1 int
+}
+
+// Algorithm returns the edit script turning a into b.
+type Algorithm func(a, b []string) []Edit
+
+// Algorithms maps the names accepted on the command line to algorithms.
+var Algorithms = map[string]Algorithm{
+	"myers":     Myers,
+	"histogram": Histogram,
+	"patience":  Patience,
+}
+
+// Default is the algorithm used when none is chosen.
+var Default Algorithm = Histogram
+
+// differ holds the interned lines of both sides and marks the lines that are
+// not part of the common subsequence.
+type differ struct {
+	a, b     []int
+	changedA []bool
+	changedB []bool
+}
+
+func newDiffer(a, b []string) *differ {
+	ids := map[string]int{}
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	return &differ{
+		a:        intern(a),
+		b:        intern(b),
+		changedA: make([]bool, len(a)),
+		changedB: make([]bool, len(b)),
+	}
+}
+
+// trim removes the common prefix and suffix of a region.
+func (d *differ) trim(aLo, aHi, bLo, bHi int) (int, int, int, int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	return aLo, aHi, bLo, bHi
+}
+
+// markChanged marks a whole region as deleted and inserted.
+func (d *differ) markChanged(aLo, aHi, bLo, bHi int) {
+	for i := aLo; i < aHi; i++ {
+		d.changedA[i] = true
+	}
+	for j := bLo; j < bHi; j++ {
+		d.changedB[j] = true
+	}
+}
+
+// edits turns the changed marks into runs.
+func (d *differ) edits() []Edit {
+	var edits []Edit
+	add := func(op Op, a0, a1, b0, b1 int) {
+		if a0 == a1 && b0 == b1 {
+			return
+		}
+		if n := len(edits); n > 0 && edits[n-1].Op == op {
+			edits[n-1].A1 = a1
+			edits[n-1].B1 = b1
+			return
+		}
+		edits = append(edits, Edit{op, a0, a1, b0, b1})
+	}
+	i, j := 0, 0
+	for i < len(d.a) || j < len(d.b) {
+		switch {
+		case i < len(d.a) && d.changedA[i]:
+			add(Delete, i, i+1, j, j)
+			i++
+		case j < len(d.b) && d.changedB[j]:
+			add(Insert, i, i, j, j+1)
+			j++
+		default:
+			add(Equal, i, i+1, j, j+1)
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+// LCS returns the longest common subsequence of a and b found by the default
+// algorithm.
+func LCS(a, b []string) []string {
+	var common []string
+	for _, edit := range Default(a, b) {
+		if edit.Op == Equal {
+			common = append(common, a[edit.A0:edit.A1]...)
+		}
+	}
+	return common
+}
@@ -0,0 +1,156 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, " ")
+}
+
+// checkScript fails unless the edits cover a and b in order, equal runs hold
+// the same lines and applying them to a gives b. It returns the number of
+// equal lines.
+func checkScript(t *testing.T, name string, a, b []string, edits []Edit) int {
+	t.Helper()
+	i, j, equal := 0, 0, 0
+	var out []string
+	for _, e := range edits {
+		if e.A0 != i || e.B0 != j || e.A1 < e.A0 || e.B1 < e.B0 || e.A1 > len(a) || e.B1 > len(b) {
+			t.Fatalf("%s: edit %+v doesn't follow a[:%d] b[:%d]", name, e, i, j)
+		}
+		switch e.Op {
+		case Equal:
+			if e.A1-e.A0 != e.B1-e.B0 {
+				t.Fatalf("%s: equal run %+v of different lengths", name, e)
+			}
+			for k := 0; k < e.A1-e.A0; k++ {
+				if a[e.A0+k] != b[e.B0+k] {
+					t.Fatalf("%s: equal run %+v holds different lines", name, e)
+				}
+			}
+			out = append(out, a[e.A0:e.A1]...)
+			equal += e.A1 - e.A0
+		case Delete:
+			if e.B0 != e.B1 {
+				t.Fatalf("%s: delete %+v inserts lines", name, e)
+			}
+		case Insert:
+			if e.A0 != e.A1 {
+				t.Fatalf("%s: insert %+v deletes lines", name, e)
+			}
+			out = append(out, b[e.B0:e.B1]...)
+		}
+		i, j = e.A1, e.B1
+	}
+	if i != len(a) || j != len(b) {
+		t.Fatalf("%s: edits stop at a[:%d] b[:%d] of %d and %d lines", name, i, j, len(a), len(b))
+	}
+	if !equalLines(out, b) {
+		t.Fatalf("%s: applying the edits gives %q, want %q", name, out, b)
+	}
+	return equal
+}
+
+// lcsLength is the length of the longest common subsequence by dynamic
+// programming.
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func TestAlgorithms(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"", "x y z"},
+		{"x y z", ""},
+		{"a b c", "a b c"},
+		{"a b c", "a x c"},
+		{"a b c d", "d c b a"},
+		{"a b a b a b", "b a b a"},
+		{"x a b c x a b c", "a b c x a b c x"},
+		{"} } } }", "} x } } y }"},
+		{"a", "b"},
+	}
+	for name, alg := range Algorithms {
+		for _, test := range tests {
+			a, b := lines(test.a), lines(test.b)
+			label := fmt.Sprintf("%s(%q, %q)", name, test.a, test.b)
+			equal := checkScript(t, label, a, b, alg(a, b))
+			if name == "myers" && equal != lcsLength(a, b) {
+				t.Errorf("%s: %d equal lines, the longest common subsequence has %d", label, equal, lcsLength(a, b))
+			}
+		}
+	}
+}
+
+func randomLines(r *rand.Rand, n, alphabet int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprint(r.Intn(alphabet))
+	}
+	return out
+}
+
+func TestMyersMinimal(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for k := 0; k < 500; k++ {
+		a := randomLines(r, r.Intn(20), 4)
+		b := randomLines(r, r.Intn(20), 4)
+		label := fmt.Sprintf("myers(%q, %q)", a, b)
+		if equal := checkScript(t, label, a, b, Myers(a, b)); equal != lcsLength(a, b) {
+			t.Fatalf("%s: %d equal lines, the longest common subsequence has %d", label, equal, lcsLength(a, b))
+		}
+	}
+}
+
+func TestLargeInputs(t *testing.T) {
+	const n = 50000
+	r := rand.New(rand.NewSource(2))
+	a := make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprintf("line %d\n", i)
+	}
+	// a few scattered edits
+	b := append([]string(nil), a...)
+	for k := 0; k < 100; k++ {
+		b[r.Intn(n)] = fmt.Sprintf("changed %d\n", k)
+	}
+	// no line in common
+	different := make([]string, n)
+	for i := range different {
+		different[i] = fmt.Sprintf("other %d\n", i)
+	}
+	for name, alg := range Algorithms {
+		if equal := checkScript(t, name+" similar", a, b, alg(a, b)); equal < n-100 {
+			t.Errorf("%s: only %d equal lines out of %d with 100 changed", name, equal, n)
+		}
+		if equal := checkScript(t, name+" different", a, different, alg(a, different)); equal != 0 {
+			t.Errorf("%s: %d equal lines between inputs without common lines", name, equal)
+		}
+		checkScript(t, name+" empty", a, nil, alg(a, nil))
+		checkScript(t, name+" from empty", nil, a, alg(nil, a))
+	}
+}
@@ -0,0 +1,178 @@
+package diff
+
+import "sort"
+
+// maxChainLength is the number of occurrences above which a line is too
+// common to be used as an anchor by the histogram algorithm.
+const maxChainLength = 64
+
+// Histogram anchors the diff on the least frequent common lines and splits
+// the problem around them, falling back to Myers for regions without a
+// usable anchor. It usually produces more readable diffs than Myers.
+func Histogram(a, b []string) []Edit {
+	d := newDiffer(a, b)
+	d.histogram(0, len(d.a), 0, len(d.b))
+	return d.edits()
+}
+
+// Patience anchors the diff on the longest increasing sequence of lines that
+// are unique on both sides, falling back to Myers between anchors without
+// unique lines.
+func Patience(a, b []string) []Edit {
+	d := newDiffer(a, b)
+	d.patience(0, len(d.a), 0, len(d.b))
+	return d.edits()
+}
+
+func (d *differ) histogram(aLo, aHi, bLo, bHi int) {
+	for {
+		aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+		if aLo == aHi || bLo == bHi {
+			d.markChanged(aLo, aHi, bLo, bHi)
+			return
+		}
+
+		positions := map[int][]int{} // line -> positions in a
+		for i := aLo; i < aHi; i++ {
+			positions[d.a[i]] = append(positions[d.a[i]], i)
+		}
+
+		bestCount := maxChainLength + 1
+		bestA0, bestA1, bestB0, bestB1 := -1, -1, -1, -1
+		for j := bLo; j < bHi; {
+			candidates := positions[d.b[j]]
+			next := j + 1
+			if len(candidates) == 0 || len(candidates) > bestCount {
+				j = next
+				continue
+			}
+			for _, i := range candidates {
+				// extend the match around (i, j) and use the count of its
+				// rarest line
+				a0, b0 := i, j
+				for a0 > aLo && b0 > bLo && d.a[a0-1] == d.b[b0-1] {
+					a0--
+					b0--
+				}
+				a1, b1 := i+1, j+1
+				for a1 < aHi && b1 < bHi && d.a[a1] == d.b[b1] {
+					a1++
+					b1++
+				}
+				count := len(candidates)
+				for k := a0; k < a1; k++ {
+					if c := len(positions[d.a[k]]); c < count {
+						count = c
+					}
+				}
+				// prefer rare, long and then central anchors so the
+				// regions left on both sides stay balanced
+				better := count < bestCount || (count == bestCount && a1-a0 > bestA1-bestA0)
+				if count == bestCount && a1-a0 == bestA1-bestA0 {
+					middle := (aLo + aHi) / 2
+					better = abs(a0+a1-2*middle) < abs(bestA0+bestA1-2*middle)
+				}
+				if better {
+					bestCount = count
+					bestA0, bestA1, bestB0, bestB1 = a0, a1, b0, b1
+				}
+				// the lines inside the match can't start a better one
+				if b1 > next {
+					next = b1
+				}
+			}
+			j = next
+		}
+
+		if bestA0 == -1 {
+			d.myers(aLo, aHi, bLo, bHi)
+			return
+		}
+		// recurse on the smaller side of the anchor and loop on the other
+		if bestA0-aLo+bestB0-bLo < aHi-bestA1+bHi-bestB1 {
+			d.histogram(aLo, bestA0, bLo, bestB0)
+			aLo, bLo = bestA1, bestB1
+		} else {
+			d.histogram(bestA1, aHi, bestB1, bHi)
+			aHi, bHi = bestA0, bestB0
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (d *differ) patience(aLo, aHi, bLo, bHi int) {
+	aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+	if aLo == aHi || bLo == bHi {
+		d.markChanged(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	type occurrences struct {
+		countA, countB int
+		posA, posB     int
+	}
+	lines := map[int]*occurrences{}
+	for i := aLo; i < aHi; i++ {
+		o, ok := lines[d.a[i]]
+		if !ok {
+			o = &occurrences{}
+			lines[d.a[i]] = o
+		}
+		o.countA++
+		o.posA = i
+	}
+	for j := bLo; j < bHi; j++ {
+		if o, ok := lines[d.b[j]]; ok {
+			o.countB++
+			o.posB = j
+		}
+	}
+
+	// lines unique on both sides ordered by their position in b
+	type anchor struct{ a, b int }
+	var unique []anchor
+	for _, o := range lines {
+		if o.countA == 1 && o.countB == 1 {
+			unique = append(unique, anchor{o.posA, o.posB})
+		}
+	}
+	if len(unique) == 0 {
+		d.myers(aLo, aHi, bLo, bHi)
+		return
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i].b < unique[j].b })
+
+	// longest increasing subsequence of the positions in a (patience sort)
+	var piles []int // index in unique of the top of each pile
+	prev := make([]int, len(unique))
+	for i, u := range unique {
+		p := sort.Search(len(piles), func(k int) bool { return unique[piles[k]].a > u.a })
+		if p > 0 {
+			prev[i] = piles[p-1]
+		} else {
+			prev[i] = -1
+		}
+		if p == len(piles) {
+			piles = append(piles, i)
+		} else {
+			piles[p] = i
+		}
+	}
+	var anchors []anchor
+	for i := piles[len(piles)-1]; i != -1; i = prev[i] {
+		anchors = append(anchors, unique[i])
+	}
+
+	a0, b0 := aLo, bLo
+	for k := len(anchors) - 1; k >= 0; k-- {
+		d.patience(a0, anchors[k].a, b0, anchors[k].b)
+		a0, b0 = anchors[k].a+1, anchors[k].b+1
+	}
+	d.patience(a0, aHi, b0, bHi)
+}
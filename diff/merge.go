@@ -0,0 +1,155 @@
+package diff
+
+// Labels are written after the conflict markers.
+type Labels struct {
+	Ours   string
+	Base   string
+	Theirs string
+}
+
+// Favor selects the side taken by Merge3 for conflicting changes.
+type Favor int
+
+const (
+	FavorNone   Favor = iota // write conflict markers
+	FavorOurs                // take our lines
+	FavorTheirs              // take their lines
+)
+
+// hunk replaces base[A0:A1] with lines on one side of a merge.
+type hunk struct {
+	A0, A1 int
+	Lines  []string
+}
+
+// hunks groups the deletions and insertions between two equal runs.
+func hunks(base, side []string) []hunk {
+	var out []hunk
+	inHunk := false
+	for _, edit := range Default(base, side) {
+		if edit.Op == Equal {
+			inHunk = false
+			continue
+		}
+		if !inHunk {
+			out = append(out, hunk{A0: edit.A0, A1: edit.A0})
+			inHunk = true
+		}
+		h := &out[len(out)-1]
+		if edit.Op == Delete {
+			h.A1 = edit.A1
+		} else {
+			h.Lines = append(h.Lines, side[edit.B0:edit.B1]...)
+		}
+	}
+	return out
+}
+
+// apply returns base[a0:a1] with the hunks, which must lie inside the range,
+// applied.
+func apply(base []string, a0, a1 int, hs []hunk) []string {
+	var out []string
+	pos := a0
+	for _, h := range hs {
+		out = append(out, base[pos:h.A0]...)
+		out = append(out, h.Lines...)
+		pos = h.A1
+	}
+	return append(out, base[pos:a1]...)
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge3 merges the changes made to base by ours and theirs. Changes to
+// separate regions are combined and overlapping changes that differ are
+// written between conflict markers, or replaced by the side chosen by favor.
+// Lines are expected to keep their "\n". It returns the merged lines and the
+// number of conflicts.
+func Merge3(base, ours, theirs []string, labels Labels, favor Favor) ([]string, int) {
+	oursHunks := hunks(base, ours)
+	theirsHunks := hunks(base, theirs)
+
+	var out []string
+	conflicts := 0
+	pos := 0
+	i, j := 0, 0
+	for i < len(oursHunks) || j < len(theirsHunks) {
+		// start a group with the first hunk and grow it with every hunk of
+		// either side that overlaps or touches it
+		var start, end int
+		if j >= len(theirsHunks) || i < len(oursHunks) && oursHunks[i].A0 <= theirsHunks[j].A0 {
+			start, end = oursHunks[i].A0, oursHunks[i].A1
+		} else {
+			start, end = theirsHunks[j].A0, theirsHunks[j].A1
+		}
+		i0, j0 := i, j
+		for {
+			if i < len(oursHunks) && oursHunks[i].A0 <= end {
+				if oursHunks[i].A1 > end {
+					end = oursHunks[i].A1
+				}
+				i++
+			} else if j < len(theirsHunks) && theirsHunks[j].A0 <= end {
+				if theirsHunks[j].A1 > end {
+					end = theirsHunks[j].A1
+				}
+				j++
+			} else {
+				break
+			}
+		}
+
+		out = append(out, base[pos:start]...)
+		oursLines := apply(base, start, end, oursHunks[i0:i])
+		theirsLines := apply(base, start, end, theirsHunks[j0:j])
+		switch {
+		case i == i0:
+			out = append(out, theirsLines...)
+		case j == j0:
+			out = append(out, oursLines...)
+		case equalLines(oursLines, theirsLines) || favor == FavorOurs:
+			out = append(out, oursLines...)
+		case favor == FavorTheirs:
+			out = append(out, theirsLines...)
+		default:
+			conflicts++
+			out = append(out, marker("<<<<<<<", labels.Ours))
+			out = appendSection(out, oursLines)
+			out = append(out, marker("|||||||", labels.Base))
+			out = appendSection(out, base[start:end])
+			out = append(out, marker("=======", ""))
+			out = appendSection(out, theirsLines)
+			out = append(out, marker(">>>>>>>", labels.Theirs))
+		}
+		pos = end
+	}
+	out = append(out, base[pos:]...)
+	return out, conflicts
+}
+
+func marker(m string, label string) string {
+	if label == "" {
+		return m + "\n"
+	}
+	return m + " " + label + "\n"
+}
+
+// appendSection adds the lines of one side of a conflict making sure the
+// next marker starts on its own line.
+func appendSection(out []string, lines []string) []string {
+	out = append(out, lines...)
+	if n := len(out); n > 0 && len(out[n-1]) > 0 && out[n-1][len(out[n-1])-1] != '\n' {
+		out[n-1] += "\n"
+	}
+	return out
+}
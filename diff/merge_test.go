@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func nl(s string) []string {
+	var out []string
+	for _, line := range lines(s) {
+		out = append(out, line+"\n")
+	}
+	return out
+}
+
+// randomEdit inserts, deletes or changes a few random lines of base.
+func randomEdit(r *rand.Rand, base []string) []string {
+	out := append([]string(nil), base...)
+	for k := r.Intn(4); k > 0; k-- {
+		i := r.Intn(len(out) + 1)
+		switch r.Intn(3) {
+		case 0:
+			out = append(out[:i], append([]string{fmt.Sprintf("new %d\n", r.Intn(5))}, out[i:]...)...)
+		case 1:
+			if i < len(out) {
+				out = append(out[:i], out[i+1:]...)
+			}
+		default:
+			if i < len(out) {
+				out[i] = fmt.Sprintf("changed %d\n", r.Intn(5))
+			}
+		}
+	}
+	return out
+}
+
+func randomBase(r *rand.Rand) []string {
+	base := randomLines(r, r.Intn(15), 6)
+	for i := range base {
+		base[i] += "\n"
+	}
+	return base
+}
+
+func TestMerge3(t *testing.T) {
+	labels := Labels{Ours: "ours", Base: "base", Theirs: "theirs"}
+	conflict := "<<<<<<< ours\nb1\n||||||| base\nb\n=======\nb2\n>>>>>>> theirs\n"
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		conflicts          int
+	}{
+		{"all empty", "", "", "", "", 0},
+		{"unchanged", "a b c", "a b c", "a b c", "a\nb\nc\n", 0},
+		{"ours only", "a b c", "a x c", "a b c", "a\nx\nc\n", 0},
+		{"theirs only", "a b c", "a b c", "a b y", "a\nb\ny\n", 0},
+		{"same change", "a b c", "a x c", "a x c", "a\nx\nc\n", 0},
+		{"separate changes", "a b c d e", "x b c d e", "a b c d y", "x\nb\nc\nd\ny\n", 0},
+		{"add to empty base", "", "a", "", "a\n", 0},
+		{"both delete everything", "a b", "", "", "", 0},
+		{"conflict", "a b c", "a b1 c", "a b2 c", "a\n" + conflict + "c\n", 1},
+		{"add/add", "", "a", "b", "<<<<<<< ours\na\n||||||| base\n=======\nb\n>>>>>>> theirs\n", 1},
+	}
+	for _, test := range tests {
+		merged, conflicts := Merge3(nl(test.base), nl(test.ours), nl(test.theirs), labels, FavorNone)
+		if got := strings.Join(merged, ""); got != test.want || conflicts != test.conflicts {
+			t.Errorf("%s: got %q with %d conflicts, want %q with %d", test.name, got, conflicts, test.want, test.conflicts)
+		}
+	}
+}
+
+// TestMerge3Invariants checks on random inputs that a side equal to the base
+// or to the other side always merges cleanly to the other side.
+func TestMerge3Invariants(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for k := 0; k < 500; k++ {
+		base := randomBase(r)
+		ours, theirs := randomEdit(r, base), randomEdit(r, base)
+		cases := []struct {
+			name               string
+			base, ours, theirs []string
+			want               []string
+		}{
+			{"theirs unchanged", base, ours, base, ours},
+			{"ours unchanged", base, base, theirs, theirs},
+			{"same on both sides", base, ours, ours, ours},
+		}
+		for _, c := range cases {
+			merged, conflicts := Merge3(c.base, c.ours, c.theirs, Labels{}, FavorNone)
+			if conflicts != 0 || !equalLines(merged, c.want) {
+				t.Fatalf("%s: Merge3(%q, %q, %q) = %q with %d conflicts, want %q", c.name, c.base, c.ours, c.theirs, merged, conflicts, c.want)
+			}
+		}
+	}
+}
+
+func TestMerge3Favor(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		favor              Favor
+		want               string
+	}{
+		{"favor ours", "a b c", "a b1 c", "a b2 c", FavorOurs, "a\nb1\nc\n"},
+		{"favor theirs", "a b c", "a b1 c", "a b2 c", FavorTheirs, "a\nb2\nc\n"},
+		{"favor ours, separate changes", "a b c d e", "x b c d e", "a b c d y", FavorOurs, "x\nb\nc\nd\ny\n"},
+		{"favor theirs, add/add", "", "a", "b", FavorTheirs, "b\n"},
+	}
+	for _, test := range tests {
+		merged, conflicts := Merge3(nl(test.base), nl(test.ours), nl(test.theirs), Labels{}, test.favor)
+		if got := strings.Join(merged, ""); got != test.want || conflicts != 0 {
+			t.Errorf("%s: got %q with %d conflicts, want %q", test.name, got, conflicts, test.want)
+		}
+	}
+}
+
+// TestMerge3FavorInvariants checks on random inputs that favoring a side
+// never leaves conflicts.
+func TestMerge3FavorInvariants(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	for k := 0; k < 500; k++ {
+		base := randomBase(r)
+		ours, theirs := randomEdit(r, base), randomEdit(r, base)
+		for _, favor := range []Favor{FavorOurs, FavorTheirs} {
+			merged, conflicts := Merge3(base, ours, theirs, Labels{}, favor)
+			if conflicts != 0 {
+				t.Fatalf("Merge3(%q, %q, %q) favoring %d left %d conflicts", base, ours, theirs, favor, conflicts)
+			}
+			for _, line := range merged {
+				if strings.HasPrefix(line, "<<<<<<<") || strings.HasPrefix(line, ">>>>>>>") {
+					t.Fatalf("Merge3(%q, %q, %q) favoring %d wrote conflict markers: %q", base, ours, theirs, favor, merged)
+				}
+			}
+		}
+	}
+}
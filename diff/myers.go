@@ -0,0 +1,136 @@
+package diff
+
+// Myers finds a shortest edit script with the linear space variant of
+// Myers' algorithm, splitting the problem at the middle snake.
+func Myers(a, b []string) []Edit {
+	d := newDiffer(a, b)
+	d.myers(0, len(d.a), 0, len(d.b))
+	return d.edits()
+}
+
+func (d *differ) myers(aLo, aHi, bLo, bHi int) {
+	for {
+		aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+		if aLo == aHi || bLo == bHi {
+			d.markChanged(aLo, aHi, bLo, bHi)
+			return
+		}
+		x, y, ok := d.middleSnake(aLo, aHi, bLo, bHi)
+		if !ok || (x == aLo && y == bLo) || (x == aHi && y == bHi) {
+			d.markChanged(aLo, aHi, bLo, bHi)
+			return
+		}
+		// recurse on the smaller half and loop on the other one to keep
+		// the stack shallow
+		if x-aLo+y-bLo < aHi-x+bHi-y {
+			d.myers(aLo, x, bLo, y)
+			aLo, bLo = x, y
+		} else {
+			d.myers(x, aHi, y, bHi)
+			aHi, bHi = x, y
+		}
+	}
+}
+
+// costLimit bounds the number of steps of the middle snake search. Past it
+// the furthest reaching forward path is used as the split point, which keeps
+// very different large inputs fast at the cost of a longer edit script.
+func costLimit(n, m int) int {
+	limit := 1
+	for limit*limit < n+m {
+		limit++
+	}
+	if limit < 256 {
+		limit = 256
+	}
+	return limit
+}
+
+// middleSnake runs the forward and backward searches until they overlap and
+// returns a point on a shortest edit path that splits the region.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	limit := costLimit(n, m)
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	vf := make([]int, 2*offset+1)
+	vb := make([]int, 2*offset+1)
+	for i := range vf {
+		vf[i] = -1
+		vb[i] = -1
+	}
+	vf[offset+1] = 0
+	vb[offset+1] = 0
+	delta := n - m
+	odd := delta%2 != 0
+	// bounds of the diagonals that are still inside the region
+	kfStart, kfEnd, kbStart, kbEnd := 0, 0, 0, 0
+
+	for step := 0; step < maxD; step++ {
+		for k := -step + kfStart; k <= step-kfEnd; k += 2 {
+			var x int
+			if k == -step || (k != step && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+			if x > n {
+				kfEnd += 2
+			} else if y > m {
+				kfStart += 2
+			} else if odd {
+				kb := delta - k
+				if kb >= -offset && kb <= offset && vb[offset+kb] != -1 && x >= n-vb[offset+kb] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+		for k := -step + kbStart; k <= step-kbEnd; k += 2 {
+			var x int
+			if k == -step || (k != step && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[offset+k] = x
+			if x > n {
+				kbEnd += 2
+			} else if y > m {
+				kbStart += 2
+			} else if !odd {
+				kf := delta - k
+				if kf >= -offset && kf <= offset && vf[offset+kf] != -1 {
+					xf := vf[offset+kf]
+					if xf >= n-x {
+						return aLo + xf, bLo + xf - kf, true
+					}
+				}
+			}
+		}
+		if step >= limit {
+			bestX, bestY := -1, -1
+			for k := -step + kfStart; k <= step-kfEnd; k += 2 {
+				x := vf[offset+k]
+				y := x - k
+				if x >= 0 && x <= n && y >= 0 && y <= m && x+y > bestX+bestY {
+					bestX, bestY = x, y
+				}
+			}
+			if bestX != -1 {
+				return aLo + bestX, bLo + bestY, true
+			}
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GetEditor returns the editor command from $EDITOR or $VISUAL, vi otherwise
+func GetEditor() string {
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor
+	}
+	if editor := os.Getenv("VISUAL"); editor != "" {
+		return editor
+	}
+	return "vi"
+}
+
+// RunEditor opens the file in the editor and waits for it to exit. It
+// returns false if the editor failed
+func RunEditor(path string) bool {
+	fields := strings.Fields(GetEditor())
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("Editor %s failed: %s\n", GetEditor(), err)
+		return false
+	}
+	return true
+}
+
+// EditFile writes the content followed by the comment lines (prefixed with
+// "# ") to path, opens it in the editor and returns the edited content
+// without the comment lines. It returns false if the editor failed
+func EditFile(path string, content string, comments []string) (string, bool) {
+	for _, comment := range comments {
+		content += "# " + comment + "\n"
+	}
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		panic(err)
+	}
+	if !RunEditor(path) {
+		return "", false
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), true
+}
+
+// EditMessage lets the user edit a commit message. The message is kept if
+// the editor fails or the edited message is empty
+func EditMessage(message string, comments []string) string {
+	comments = append(comments, "Lines starting with '#' are ignored, an empty message keeps the original one.")
+	edited, ok := EditFile(".gogit/COMMIT_EDITMSG", message+"\n\n", comments)
+	if !ok || edited == "" {
+		return message
+	}
+	return edited
+}
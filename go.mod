@@ -7,5 +7,5 @@ require github.com/spf13/cobra v1.6.1
 require (
 	github.com/hbollon/go-edlib v1.6.0
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/spf13/pflag v1.0.5
 )
@@ -18,4 +18,34 @@ func HashFile(f *os.File) string {
 	h := sha512.New()
 	io.Copy(h, f)
 	return fmt.Sprintf("%x", h.Sum(nil))
-}
\ No newline at end of file
+}
+
+// HashWorkingFile hashes a file of the working directory like ReadWorkingFile
+// reads it
+func HashWorkingFile(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil {
+		panic(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return HashContent(ReadWorkingFile(path))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	return HashFile(f)
+}
+
+func HashContent(b []byte) string {
+	return fmt.Sprintf("%x", sha512.Sum512(b))
+}
+
+// ShortHash returns the first characters of a hash for display
+func ShortHash(hash string) string {
+	if len(hash) > 10 {
+		return hash[:10]
+	}
+	return hash
+}
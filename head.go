@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+	.gogit/HEAD is either symbolic, "ref: branches/<name>", in which case the
+	commits made move the branch, or the hash of a commit when HEAD is
+	detached, in which case they only move HEAD.
+
+	Repositories from before symbolic HEADs stored the hash in HEAD and the
+	branch in .gogit/HEAD_BRANCH. They are migrated the first time HEAD is
+	read: HEAD points to the branch if both were on the same commit and is
+	detached otherwise.
+*/
+
+const headRefPrefix = "ref: branches/"
+
+// readHead returns the content of .gogit/HEAD
+func readHead() string {
+	b, err := ioutil.ReadFile(".gogit/HEAD")
+	if err != nil && !os.IsNotExist(err) {
+		panic(err)
+	}
+	head := strings.TrimSpace(string(b))
+	if branch, err := ioutil.ReadFile(".gogit/HEAD_BRANCH"); err == nil {
+		name := strings.TrimSpace(string(branch))
+		if name != "" && (head == "" || head == GetBranchCommit(name)) {
+			head = headRefPrefix + name
+		}
+		writeHead(head)
+		os.Remove(".gogit/HEAD_BRANCH")
+	}
+	return head
+}
+
+func writeHead(content string) {
+	err := ioutil.WriteFile(".gogit/HEAD", []byte(content), 0666)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// GetHead returns the hash of the commit HEAD points to, "" if there is none
+// yet
+func GetHead() string {
+	head := readHead()
+	if !strings.HasPrefix(head, headRefPrefix) {
+		return head
+	}
+	branch := strings.TrimPrefix(head, headRefPrefix)
+	if _, err := os.Stat(".gogit/branches/" + branch); err != nil {
+		return ""
+	}
+	return GetBranchCommit(branch)
+}
+
+// GetHeadBranch returns the branch HEAD points to, "" if HEAD is detached
+func GetHeadBranch() string {
+	head := readHead()
+	if !strings.HasPrefix(head, headRefPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(head, headRefPrefix)
+}
+
+// SaveHead moves HEAD to the commit, along with the branch it points to
+func SaveHead(commit *Commit) {
+	if branch := GetHeadBranch(); branch != "" {
+		CreateBranch(branch, commit.Hash)
+		return
+	}
+	writeHead(commit.Hash)
+}
+
+// SaveHeadBranch makes HEAD point to the branch
+func SaveHeadBranch(branch string) {
+	writeHead(headRefPrefix + branch)
+}
+
+// DetachHead makes HEAD point to the commit without a branch
+func DetachHead(commit *Commit) {
+	writeHead(commit.Hash)
+}
+
+// WarnUnreferenced warns about the commits before old, a detached HEAD that
+// was left, that can't be reached from a branch or the current HEAD anymore
+func WarnUnreferenced(old *Commit) {
+	referenced := map[string]bool{}
+	heads := append(*GetAllBranchHeads(), GetHead())
+	for _, hash := range heads {
+		if c := GetCommit(hash); c != nil {
+			for ancestor := range Ancestors(c) {
+				referenced[ancestor] = true
+			}
+		}
+	}
+	var lost []*Commit
+	for hash, c := range Ancestors(old) {
+		if !referenced[hash] {
+			lost = append(lost, c)
+		}
+	}
+	if len(lost) == 0 {
+		return
+	}
+	fmt.Printf("Warning: you are leaving %d commit(s) behind, not connected to any of your branches:\n", len(lost))
+	sort.Slice(lost, func(i, j int) bool {
+		return lost[i].Time > lost[j].Time
+	})
+	for _, c := range lost {
+		fmt.Printf("  %s %s\n", ShortHash(c.Hash), c.Subject())
+	}
+	fmt.Printf("If you want to keep them, create a branch with: gogit branch create <name> %s\n", old.Hash)
+}
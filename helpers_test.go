@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// newTestRepo changes to an empty repository in a temporary directory for
+// the duration of the test
+func newTestRepo(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+	Initialize()
+}
+
+// gogit runs a command like the command line does
+func gogit(t *testing.T, args ...string) {
+	t.Helper()
+	resetFlags(rootCmd)
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("gogit %v: %s", args, err)
+	}
+}
+
+// resetFlags sets the flags of the commands back to their defaults, the
+// globals they are parsed into keep the values of the previous command
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		f.Value.Set(f.DefValue)
+		f.Changed = false
+	})
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+func writeFile(t *testing.T, relativePath string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(relativePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(relativePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, relativePath string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(relativePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// commitFile writes the file, adds it and commits it
+func commitFile(t *testing.T, relativePath string, content string, message string) {
+	t.Helper()
+	writeFile(t, relativePath, content)
+	gogit(t, "add", relativePath)
+	gogit(t, "commit", message)
+}
+
+// checkUntouched fails if the untracked file doesn't have its content anymore
+// or HEAD moved
+func checkUntouched(t *testing.T, relativePath string, content string, head string) {
+	t.Helper()
+	if got := readFile(t, relativePath); got != content {
+		t.Errorf("untracked %s was overwritten with %q", relativePath, got)
+	}
+	if _, ok := GetIndex()[relativePath]; ok {
+		t.Errorf("untracked %s was added to the index", relativePath)
+	}
+	if GetHead() != head {
+		t.Errorf("HEAD moved from %s to %s", ShortHash(head), ShortHash(GetHead()))
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+/*
+	Ignore rules are read from the .gogitignore file of every directory and
+	follow the gitignore format:
+
+	- Blank lines and lines starting with "#" are skipped
+	- A leading "!" re-includes paths excluded by an earlier rule
+	- A trailing "/" only matches directories
+	- A pattern with a "/" at the start or in the middle is matched against
+	  the path relative to the directory of the .gogitignore, otherwise it is
+	  matched against the name of the file or directory
+	- "*", "?" and "[...]" match within a path segment and "**" matches any
+	  number of segments
+
+	Rules of deeper directories and later lines take precedence. Paths inside
+	an ignored directory are always ignored.
+*/
+
+const IgnoreFile = ".gogitignore"
+
+type IgnoreRule struct {
+	Pattern  string // Pattern without the "!" and the leading and trailing "/"
+	Negate   bool   // Whether the rule re-includes paths
+	DirOnly  bool   // Whether the rule only matches directories
+	Anchored bool   // Whether the pattern is relative to Base instead of a name
+	Base     string // Directory of the ignore file ("." for the root)
+	Source   string // Path of the ignore file
+	Line     int    // Line of the rule in the ignore file
+	Text     string // Rule as written in the ignore file
+}
+
+type Ignore struct {
+	rules map[string][]IgnoreRule // directory -> rules of its ignore file
+}
+
+func NewIgnore() *Ignore {
+	return &Ignore{map[string][]IgnoreRule{}}
+}
+
+func ParseIgnoreFile(base string, source string, content string) []IgnoreRule {
+	var rules []IgnoreRule
+	for i, line := range strings.Split(content, "\n") {
+		text := strings.TrimRight(line, " \r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule := IgnoreRule{Base: base, Source: source, Line: i + 1, Text: text}
+		pattern := text
+		if strings.HasPrefix(pattern, "!") {
+			rule.Negate = true
+			pattern = pattern[1:]
+		} else if strings.HasPrefix(pattern, "\\") {
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			rule.DirOnly = true
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		if strings.Contains(pattern, "/") {
+			rule.Anchored = true
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+		if pattern == "" {
+			continue
+		}
+		rule.Pattern = pattern
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func (ig *Ignore) rulesFor(dir string) []IgnoreRule {
+	if rules, ok := ig.rules[dir]; ok {
+		return rules
+	}
+	source := path.Join(dir, IgnoreFile)
+	var rules []IgnoreRule
+	b, err := ioutil.ReadFile(source)
+	if err == nil {
+		rules = ParseIgnoreFile(dir, source, string(b))
+	}
+	ig.rules[dir] = rules
+	return rules
+}
+
+// Match returns the rule deciding whether relativePath is ignored, without
+// looking at its parent directories, or nil if no rule matches
+func (ig *Ignore) Match(relativePath string, isDir bool) *IgnoreRule {
+	relativePath = NormalizePath(relativePath)
+	dirs := []string{"."}
+	names := strings.Split(relativePath, "/")
+	for i := 1; i < len(names); i++ {
+		dirs = append(dirs, strings.Join(names[:i], "/"))
+	}
+
+	var match *IgnoreRule
+	for _, dir := range dirs {
+		rules := ig.rulesFor(dir)
+		for i := range rules {
+			if rules[i].Matches(relativePath, isDir) {
+				match = &rules[i]
+			}
+		}
+	}
+	return match
+}
+
+// MatchWithParents is like Match but also reports the rule that ignores a
+// parent directory of relativePath
+func (ig *Ignore) MatchWithParents(relativePath string, isDir bool) *IgnoreRule {
+	names := strings.Split(NormalizePath(relativePath), "/")
+	for i := 1; i < len(names); i++ {
+		rule := ig.Match(strings.Join(names[:i], "/"), true)
+		if rule != nil && !rule.Negate {
+			return rule
+		}
+	}
+	return ig.Match(relativePath, isDir)
+}
+
+func (ig *Ignore) IsIgnored(relativePath string, isDir bool) bool {
+	rule := ig.MatchWithParents(relativePath, isDir)
+	return rule != nil && !rule.Negate
+}
+
+func (r *IgnoreRule) Matches(relativePath string, isDir bool) bool {
+	if r.DirOnly && !isDir {
+		return false
+	}
+	if r.Base != "." {
+		if !strings.HasPrefix(relativePath, r.Base+"/") {
+			return false
+		}
+		relativePath = strings.TrimPrefix(relativePath, r.Base+"/")
+	}
+	if r.Anchored {
+		return MatchGlob(strings.Split(r.Pattern, "/"), strings.Split(relativePath, "/"))
+	}
+	matched, _ := path.Match(r.Pattern, path.Base(relativePath))
+	return matched
+}
+
+// MatchGlob matches path segments against pattern segments where "**"
+// matches any number of segments
+func MatchGlob(pattern, names []string) bool {
+	if len(pattern) == 0 {
+		return len(names) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if MatchGlob(pattern[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	matched, _ := path.Match(pattern[0], names[0])
+	return matched && MatchGlob(pattern[1:], names[1:])
+}
+
+// WalkWorkingTree calls fn for every file under root that is tracked or not
+// ignored, skipping .gogit
+func WalkWorkingTree(root string, tracked map[string]bool, fn func(relativePath string, info os.FileInfo)) {
+	ignore := NewIgnore()
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath := filepath.ToSlash(p)
+		if info.IsDir() {
+			if info.Name() == ".gogit" {
+				return filepath.SkipDir
+			}
+			if relativePath != "." && ignore.IsIgnored(relativePath, true) && !HasTrackedPaths(tracked, relativePath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if tracked[relativePath] || !ignore.IsIgnored(relativePath, false) {
+			fn(relativePath, info)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func HasTrackedPaths(tracked map[string]bool, dir string) bool {
+	for relativePath := range tracked {
+		if IsUnderPath(relativePath, dir) {
+			return true
+		}
+	}
+	return false
+}
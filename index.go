@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GetIndex returns the staged files (relative path -> object). A repository
+// without an index starts from the tree of HEAD
+func GetIndex() map[string]Object {
+	index := map[string]Object{}
+	b, err := ioutil.ReadFile(".gogit/index")
+	if os.IsNotExist(err) {
+		if head := GetCommit(GetHead()); head != nil {
+			for _, object := range head.GetObjects() {
+				index[object.RelativePath] = object
+			}
+		}
+		return index
+	}
+	if err != nil {
+		panic(err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line != "" {
+			object := DeserializeObject(line)
+			index[object.RelativePath] = *object
+		}
+	}
+	return index
+}
+
+func SaveIndex(index map[string]Object) {
+	var lines []string
+	for _, object := range IndexObjects(index) {
+		lines = append(lines, object.Serialize()+"\n")
+	}
+	err := ioutil.WriteFile(".gogit/index", []byte(strings.Join(lines, "")), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// SaveIndexFromMap replaces the index with the given files (relative path ->
+// hash) and their modes (relative path -> mode, see ModeOf)
+func SaveIndexFromMap(objects map[string]string, modes map[string]string) {
+	index := map[string]Object{}
+	for relativePath, hash := range objects {
+		index[relativePath] = Object{hash, relativePath, ModeOf(modes, relativePath)}
+	}
+	SaveIndex(index)
+}
+
+// IndexObjects returns the objects of the index sorted by path
+func IndexObjects(index map[string]Object) []Object {
+	var objects []Object
+	for _, object := range index {
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].RelativePath < objects[j].RelativePath
+	})
+	return objects
+}
+
+func TrackedPaths(index map[string]Object) map[string]bool {
+	tracked := map[string]bool{}
+	for relativePath := range index {
+		tracked[relativePath] = true
+	}
+	return tracked
+}
+
+func NormalizePath(p string) string {
+	return filepath.ToSlash(filepath.Clean(p))
+}
+
+// IsUnderPath checks if relativePath is p or is inside the directory p
+func IsUnderPath(relativePath, p string) bool {
+	return p == "." || relativePath == p || strings.HasPrefix(relativePath, p+"/")
+}
+
+// AddToIndex stages the current content of the paths, including deletions
+func AddToIndex(paths []string) {
+	index := GetIndex()
+	tracked := TrackedPaths(index)
+	ignore := NewIgnore()
+	for _, p := range paths {
+		p = NormalizePath(p)
+		info, err := os.Lstat(p)
+		if err == nil && p != "." && !HasTrackedPaths(tracked, p) && ignore.IsIgnored(p, info.IsDir()) {
+			fmt.Printf("Path %s is ignored\n", p)
+			continue
+		}
+		found := false
+		for relativePath := range index {
+			if IsUnderPath(relativePath, p) {
+				delete(index, relativePath)
+				found = true
+			}
+		}
+		if err == nil {
+			for _, object := range SnapshotPath(p, tracked) {
+				index[object.RelativePath] = object
+			}
+			found = true
+		}
+		if !found {
+			fmt.Printf("Path %s did not match any files\n", p)
+		}
+	}
+	SaveIndex(index)
+}
+
+// StageTracked stages the current content of the files in the index or in
+// HEAD, including deletions. Untracked files aren't staged
+func StageTracked() {
+	index := GetIndex()
+	tracked := TrackedPaths(index)
+	if head := GetCommit(GetHead()); head != nil {
+		for relativePath := range TreeToMap(head.Tree) {
+			tracked[relativePath] = true
+		}
+	}
+	for relativePath := range tracked {
+		info, err := os.Lstat(relativePath)
+		if err != nil {
+			delete(index, relativePath)
+			continue
+		}
+		mode := FileModeOf(info)
+		if mode == DirMode {
+			// a kept directory stays kept, a file replaced by a directory
+			// is deleted
+			if index[relativePath].Mode != DirMode {
+				delete(index, relativePath)
+			}
+			continue
+		}
+		index[relativePath] = Object{WriteBlobFromFile(relativePath), relativePath, mode}
+	}
+	SaveIndex(index)
+}
+
+// RemoveFromIndex unstages the paths and deletes them from the working
+// directory unless cached is set
+func RemoveFromIndex(paths []string, cached bool) {
+	index := GetIndex()
+	for _, p := range paths {
+		p = NormalizePath(p)
+		found := false
+		for relativePath := range index {
+			if IsUnderPath(relativePath, p) {
+				delete(index, relativePath)
+				found = true
+				if !cached {
+					os.Remove(relativePath)
+				}
+			}
+		}
+		if !found {
+			fmt.Printf("Path %s is not tracked\n", p)
+		}
+	}
+	SaveIndex(index)
+}
+
+// ResetIndex sets the staged content of the paths back to HEAD's
+func ResetIndex(paths []string) {
+	index := GetIndex()
+	headObjects := map[string]string{}
+	headModes := map[string]string{}
+	if head := GetCommit(GetHead()); head != nil {
+		headObjects = TreeToMap(head.Tree)
+		headModes = TreeModes(head.Tree)
+	}
+	for _, p := range paths {
+		p = NormalizePath(p)
+		for relativePath := range index {
+			if IsUnderPath(relativePath, p) {
+				delete(index, relativePath)
+			}
+		}
+		for relativePath, hash := range headObjects {
+			if IsUnderPath(relativePath, p) {
+				index[relativePath] = Object{hash, relativePath, ModeOf(headModes, relativePath)}
+			}
+		}
+	}
+	SaveIndex(index)
+}
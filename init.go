@@ -9,6 +9,7 @@ import (
 func Initialize() {
 	os.MkdirAll(".gogit", 0755)
 	os.MkdirAll(".gogit/objects", 0755)
+	os.MkdirAll(".gogit/packs", 0755)
 	os.MkdirAll(".gogit/commits", 0755)
 	os.MkdirAll(".gogit/branches", 0755)
 	os.OpenFile(".gogit/config", os.O_RDONLY|os.O_CREATE, 0666)
@@ -39,7 +40,3 @@ func SaveConfig(commits *[]Commit) {
 	}
 	ioutil.WriteFile(".gogit/config", []byte(config), 0666)
 }
-
-func SaveHead(commit *Commit) {
-	ioutil.WriteFile(".gogit/HEAD", []byte(commit.Hash), 0666)
-}
@@ -3,282 +3,559 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
-	"os"
+	"sort"
 	"strings"
+
+	"gogit/diff"
 )
 
 /*
-	Merge Strategy when a same file is modified in two commits (provides no choice to the user):
-
-	- Find the closest LCA of the two commits (let it be 'lca')
-	- Find the LCS of 'lca' and 'x' (let it be 'lx')
-	- Find the LCS of 'lca' and 'y' (let it be 'ly')
-	- The base string now is the LCS of 'lx' and 'ly' (let it be 'lxy')
-	- Give the base string line numbers and map the lines of 'lx' and 'ly' to it
-	- Find the additions of 'lx' and 'x' and apply it to 'lxy'
-	- Find the additions of 'ly' and 'y' and apply it to 'lxy'
+	Merge Strategy when a same file is modified in two commits:
+
+	- Find the best common ancestors of the two commits, the ones that aren't
+	  before another common ancestor. If there are several of them they are
+	  merged into a virtual commit the same way (let the result be 'base')
+	- Diff 'base' against 'x' and against 'y' to find the changed regions of
+	  each side
+	- Regions changed by only one side take that side's lines
+	- Overlapping regions changed in the same way are taken once
+	- Overlapping regions changed differently are conflicts: the file is
+	  written with both versions and the base between conflict markers and the
+	  path is recorded in .gogit/MERGE_CONFLICTS until it is resolved
+
+	Files added, deleted or renamed:
+
+	- A file deleted on one side and modified on the other is a conflict, the
+	  modified version is kept in the working directory
+	- A file added on both sides is merged against an empty base
+	- Binary files (see attributes.go) changed on both sides are conflicts,
+	  our version is kept and both versions are written to "<path>~<branch>"
+	- A file deleted on both sides is deleted
+	- A deleted file and an added file of the same side are a rename when at
+	  least half of their lines are the same. Changes made to the old path on
+	  the other side are merged into the new path
 
 */
 
-func Merge(user string, x, y *Commit, force bool) {
-	lca := LCA(x, y)
-	if lca == nil {
+// MergeOptions select how a merge is done
+type MergeOptions struct {
+	Strategy string     // StrategyRecursive or StrategyOurs
+	Favor    diff.Favor // Side taken for conflicting changes (-X ours/theirs)
+}
+
+const (
+	StrategyRecursive = "recursive" // merge the changes of both sides
+	StrategyOurs      = "ours"      // keep the tree of y and only record the merge
+)
+
+// Merge merges x into y in the working directory and returns the files with
+// conflicts. xName and yName are used as the labels of the conflict markers.
+// It returns false without changing anything if untracked files would be
+// overwritten
+func Merge(user string, x, y *Commit, xName, yName string, force bool, options MergeOptions) ([]Conflict, bool) {
+	base := MergeBase(x, y)
+	if base == nil {
 		panic("LCA not found")
 	}
 
-	baseObjects := map[string]string{} // relative path -> hash
-	for _, object := range lca.Objects {
-		baseObjects[object.RelativePath] = object.Hash
+	labels := diff.Labels{Ours: yName, Base: "base", Theirs: xName}
+	finalObjects, conflicts, conflictContents := MergeTrees(base.Tree, y.Tree, x.Tree, labels, options.Favor, false)
+
+	if len(conflicts) != 0 && !force {
+		fmt.Println("Merge failed")
+		return conflicts, true
+	}
+
+	modes := MergeModes(base.Tree, y.Tree, x.Tree, finalObjects)
+	return conflicts, ApplyMergeResult(finalObjects, modes, conflicts, conflictContents, yName, xName, "merge")
+}
+
+// ApplyMergeResult writes the result of MergeTrees, with the modes from
+// MergeModes, to the working directory and the index and records the
+// conflicts. oursName and theirsName are used for the names of the side files
+// of binary conflicts. If untracked files would be overwritten, they are
+// listed as being in the way of the command and nothing is written, it
+// returns false
+func ApplyMergeResult(finalObjects map[string]string, modes map[string]string, conflicts []Conflict, conflictContents map[string]string, oursName, theirsName string, command string) bool {
+	if !CheckUntracked(UntrackedOverwrittenBy(finalObjects, modes), command) {
+		return false
+	}
+	// the index keeps our version of conflicted files while the working
+	// directory gets the content with the conflict markers
+	ApplyMerge(finalObjects, modes)
+	for relativePath, content := range conflictContents {
+		err := ioutil.WriteFile(relativePath, []byte(content), 0644)
+		if err != nil {
+			panic(err)
+		}
+	}
+	// conflicted binary files keep our version and both versions are written
+	// next to them
+	for _, conflict := range conflicts {
+		if _, ok := conflictContents[conflict.Path]; ok || conflict.Ours == "" || conflict.Theirs == "" {
+			continue
+		}
+		oursPath := conflict.Path + "~" + strings.ReplaceAll(oursName, "/", "_")
+		theirsPath := conflict.Path + "~" + strings.ReplaceAll(theirsName, "/", "_")
+		WriteBlobToFile(conflict.Ours, oursPath)
+		WriteBlobToFile(conflict.Theirs, theirsPath)
+		fmt.Printf("Both versions of %s are kept in %s and %s\n", conflict.Path, oursPath, theirsPath)
+	}
+	SaveConflicts(conflicts)
+	return true
+}
+
+// MergeTrees merges the changes made to the base tree by ours and theirs. It
+// returns the merged files (relative path -> hash), the conflicts and the
+// content with conflict markers of the conflicted text files. The hash of
+// conflicted files in the merged files is ours. Conflicting changes to the content of a file are
+// taken from the side chosen by favor instead. Nothing is printed if quiet is
+// set
+func MergeTrees(baseTree, oursTree, theirsTree string, labels diff.Labels, favor diff.Favor, quiet bool) (map[string]string, []Conflict, map[string]string) {
+	logf := func(format string, a ...interface{}) {
+		if !quiet {
+			fmt.Printf(format, a...)
+		}
 	}
 
-	xObjects := map[string]string{}
-	for _, object := range x.Objects {
-		xObjects[object.RelativePath] = object.Hash
+	attributes := GetAttributes()
+	baseObjects := TreeToMap(baseTree) // relative path -> hash
+
+	// only the files that changed since the base need to be looked at
+	oursObjects := map[string]string{}
+	for _, change := range DiffTrees(baseTree, oursTree) {
+		oursObjects[change.Path] = change.NewHash
 	}
 
-	yObjects := map[string]string{}
-	for _, object := range y.Objects {
-		yObjects[object.RelativePath] = object.Hash
+	theirsObjects := map[string]string{}
+	for _, change := range DiffTrees(baseTree, theirsTree) {
+		theirsObjects[change.Path] = change.NewHash
 	}
 
+	oursRenames := DetectRenames(baseObjects, oursObjects)
+	theirsRenames := DetectRenames(baseObjects, theirsObjects)
+
+	var conflicts []Conflict
+	conflicts = append(conflicts, followRenames(baseObjects, theirsObjects, oursObjects, theirsRenames, oursRenames, labels.Theirs, labels.Ours, false, logf)...)
+	conflicts = append(conflicts, followRenames(baseObjects, oursObjects, theirsObjects, oursRenames, theirsRenames, labels.Ours, labels.Theirs, true, logf)...)
+
 	finalObjects := map[string]string{}
-	filesWithConflicts := []string{}
+	for relativePath, hash := range baseObjects {
+		finalObjects[relativePath] = hash
+	}
 
-	hasConflicts := false
+	conflictContents := map[string]string{} // relative path -> content with conflict markers
 
-	for relativePath, hash := range xObjects {
-		if baseObjects[relativePath] == hash && yObjects[relativePath] == baseObjects[relativePath] {
-			finalObjects[relativePath] = hash
-		} else if baseObjects[relativePath] == hash && yObjects[relativePath] != baseObjects[relativePath] {
-			// x is the same as lca, y is different
-			finalObjects[relativePath] = yObjects[relativePath]
-		} else if baseObjects[relativePath] != hash && yObjects[relativePath] == baseObjects[relativePath] {
-			// y is the same as lca, x is different
-			finalObjects[relativePath] = xObjects[relativePath]
-		} else if baseObjects[relativePath] != hash && yObjects[relativePath] != baseObjects[relativePath] {
-			// x and y are different from lca
-			fmt.Println("Conflicts found in ", relativePath)
-			hasConflicts = true
-			if force {
-				filesWithConflicts = append(filesWithConflicts, relativePath)
+	var paths []string
+	for relativePath := range theirsObjects {
+		paths = append(paths, relativePath)
+	}
+	sort.Strings(paths)
+	for _, relativePath := range paths {
+		theirsHash := theirsObjects[relativePath]
+		oursHash, ok := oursObjects[relativePath]
+		if !ok || oursHash == theirsHash {
+			// ours is the same as base or both made the same change
+			finalObjects[relativePath] = theirsHash
+			continue
+		}
+		// ours and theirs are different from base
+		baseHash := baseObjects[relativePath]
+		switch {
+		case theirsHash == "":
+			logf("CONFLICT (modify/delete): %s deleted in %s and modified in %s\n", relativePath, labels.Theirs, labels.Ours)
+			conflicts = append(conflicts, Conflict{relativePath, baseHash, oursHash, ""})
+			finalObjects[relativePath] = oursHash
+		case oursHash == "":
+			// the file is staged with their content so it can be either
+			// added or removed to resolve the conflict
+			logf("CONFLICT (modify/delete): %s deleted in %s and modified in %s\n", relativePath, labels.Ours, labels.Theirs)
+			conflicts = append(conflicts, Conflict{relativePath, baseHash, "", theirsHash})
+			finalObjects[relativePath] = theirsHash
+		case attributes.IsBinaryBlob(relativePath, oursHash) || attributes.IsBinaryBlob(relativePath, theirsHash) || attributes.IsBinaryBlob(relativePath, baseHash):
+			// binary files can't be merged line by line
+			if favor == diff.FavorTheirs {
+				finalObjects[relativePath] = theirsHash
+				continue
 			}
+			finalObjects[relativePath] = oursHash
+			if favor == diff.FavorOurs {
+				continue
+			}
+			logf("warning: Cannot merge binary files: %s (%s vs. %s)\n", relativePath, labels.Ours, labels.Theirs)
+			logf("CONFLICT (binary): Merge conflict in %s\n", relativePath)
+			conflicts = append(conflicts, Conflict{relativePath, baseHash, oursHash, theirsHash})
+		default:
+			// a file added on both sides is merged against an empty base
+			logf("Auto-merging %s\n", relativePath)
+			content, ok := ResolveConflicts(baseHash, oursHash, theirsHash, labels, favor)
+			if ok {
+				finalObjects[relativePath] = WriteObject(BlobObject, []byte(content))
+				continue
+			}
+			if baseHash == "" {
+				logf("CONFLICT (add/add): Merge conflict in %s\n", relativePath)
+			} else {
+				logf("CONFLICT (content): Merge conflict in %s\n", relativePath)
+			}
+			conflicts = append(conflicts, Conflict{relativePath, baseHash, oursHash, theirsHash})
+			conflictContents[relativePath] = content
+			finalObjects[relativePath] = oursHash
 		}
 	}
 
-	for relativePath, hash := range yObjects {
-		if baseObjects[relativePath] == hash && xObjects[relativePath] == baseObjects[relativePath] {
+	for relativePath, hash := range oursObjects {
+		if _, ok := theirsObjects[relativePath]; !ok {
+			// theirs is the same as base, ours is different
 			finalObjects[relativePath] = hash
-		} else if baseObjects[relativePath] == hash && xObjects[relativePath] != baseObjects[relativePath] {
-			// y is the same as lca, x is different
-			finalObjects[relativePath] = xObjects[relativePath]
-		} else if baseObjects[relativePath] != hash && xObjects[relativePath] == baseObjects[relativePath] {
-			// x is the same as lca, y is different
-			finalObjects[relativePath] = yObjects[relativePath]
 		}
 	}
 
-
-	if !hasConflicts {
-		for relativePath, hash := range finalObjects {
-			CopyFile(".gogit/objects/"+hash, relativePath)
+	for relativePath, hash := range finalObjects {
+		if hash == "" {
+			delete(finalObjects, relativePath)
 		}
-		ApplyMerge(finalObjects)
-		return
 	}
+	return finalObjects, conflicts, conflictContents
+}
 
-	if !force {
-		fmt.Println("Merge failed")
-		return
+// MergeModes returns the modes of the files merged by MergeTrees (relative
+// path -> mode). A mode changed by only one side since the base is taken from
+// it, ours is kept if both sides changed it
+func MergeModes(baseTree, oursTree, theirsTree string, objects map[string]string) map[string]string {
+	baseModes, oursModes, theirsModes := TreeModes(baseTree), TreeModes(oursTree), TreeModes(theirsTree)
+	modes := map[string]string{}
+	for relativePath := range objects {
+		oursMode, inOurs := oursModes[relativePath]
+		theirsMode, inTheirs := theirsModes[relativePath]
+		switch {
+		case inOurs && (!inTheirs || oursMode != baseModes[relativePath]):
+			modes[relativePath] = oursMode
+		case inTheirs:
+			modes[relativePath] = theirsMode
+		}
 	}
+	return modes
+}
 
-	for _, relativePath := range filesWithConflicts {
-		fmt.Println("Resolving conflicts in ", relativePath)
-		newContent := ResolveConflicts(baseObjects[relativePath], xObjects[relativePath], yObjects[relativePath])
-		ioutil.WriteFile(relativePath, []byte(newContent), 0644)
-		f, err := os.OpenFile(relativePath, os.O_RDONLY, 0644)
-		if err != nil {
-			panic(err)
+// followRenames goes through the files renamed by one side of a merge
+// (changes) and moves the changes the other side made to the old path to the
+// new one, so both are merged at the new path. base is updated to hold the
+// content of the old path at the new one. ours tells whether changes is the
+// side merged into. Renames to different paths on both sides and
+// renames of files deleted on the other side are returned as conflicts
+func followRenames(baseObjects, changes, otherChanges, renames, otherRenames map[string]string, name, otherName string, ours bool, logf func(string, ...interface{})) []Conflict {
+	var oldPaths []string
+	for oldPath := range renames {
+		oldPaths = append(oldPaths, oldPath)
+	}
+	sort.Strings(oldPaths)
+
+	var conflicts []Conflict
+	for _, oldPath := range oldPaths {
+		newPath := renames[oldPath]
+		otherHash, changed := otherChanges[oldPath]
+		otherPath, renamed := otherRenames[oldPath]
+		switch {
+		case renamed && otherPath == newPath:
+			// renamed the same way on both sides
+			baseObjects[newPath] = baseObjects[oldPath]
+		case renamed:
+			// reported once, from the side being merged
+			if ours {
+				continue
+			}
+			logf("CONFLICT (rename/rename): %s renamed to %s in %s and to %s in %s\n", oldPath, newPath, name, otherPath, otherName)
+			conflicts = append(conflicts,
+				Conflict{newPath, "", "", changes[newPath]},
+				Conflict{otherPath, "", otherChanges[otherPath], ""})
+		case changed && otherHash == "":
+			logf("CONFLICT (rename/delete): %s renamed to %s in %s and deleted in %s\n", oldPath, newPath, name, otherName)
+			if ours {
+				conflicts = append(conflicts, Conflict{newPath, "", changes[newPath], ""})
+			} else {
+				conflicts = append(conflicts, Conflict{newPath, "", "", changes[newPath]})
+			}
+		case changed:
+			if _, ok := otherChanges[newPath]; ok {
+				// the other side added a file at the new path, which is
+				// merged with it as an add/add
+				continue
+			}
+			logf("Following rename of %s to %s\n", oldPath, newPath)
+			baseObjects[newPath] = baseObjects[oldPath]
+			otherChanges[newPath] = otherHash
+			otherChanges[oldPath] = ""
 		}
-		defer f.Close()
-		hash := HashFile(f)
-		CopyFile(relativePath, ".gogit/objects/"+hash)
-		finalObjects[relativePath] = hash
 	}
-	ApplyMerge(finalObjects)
+	return conflicts
 }
 
-func ApplyMerge(objects map[string]string) {
-	// delete all files except .gogit
-	files, err := ioutil.ReadDir(".")
-	if err != nil {
-		panic(err)
+// StartMerge merges x into y and records the merge in progress. If there are
+// no conflicts and commit is set, the merge commit is created right away.
+// Without commit the merged files are only written, and continuing the merge
+// once the conflicts are resolved doesn't commit them either
+func StartMerge(x, y *Commit, xName, yName string, commit bool, options MergeOptions) bool {
+	bases := MergeBases(x, y)
+	if len(bases) == 0 {
+		panic("LCA not found")
+	}
+	var baseHashes []string
+	for _, base := range bases {
+		baseHashes = append(baseHashes, base.Hash)
+	}
+	message := ""
+	if commit {
+		message = "Merge " + xName + " into " + yName
 	}
-	for _, file := range files {
-		if file.Name() != ".gogit" {
-			os.RemoveAll(file.Name())
+	state := &MergeState{
+		Head:    GetHead(),
+		Ours:    y.Hash,
+		Theirs:  x.Hash,
+		Base:    strings.Join(baseHashes, ","),
+		Message: message,
+	}
+	if options.Strategy == StrategyOurs {
+		if !CheckUntracked(UntrackedOverwritten(y), "merge") {
+			return false
+		}
+		SaveMergeState(state)
+		ResetHard(y)
+		if !commit {
+			ClearMergeState()
+			return true
 		}
+		return ContinueMerge()
+	}
+	conflicts, ok := Merge("user", x, y, xName, yName, true, options)
+	if !ok {
+		return false
 	}
+	// the state is only saved once the merge is applied, so a refused
+	// merge leaves nothing behind
+	SaveMergeState(state)
+	if len(conflicts) != 0 {
+		fmt.Println("Automatic merge failed, fix the conflicts, add the files and run merge --continue")
+		return false
+	}
+	if !commit {
+		ClearMergeState()
+		return true
+	}
+	return ContinueMerge()
+}
 
-	// copy all files from objects to current directory
-	for relativePath, hash := range objects {
-		if hash != "" {
-			CopyFile(".gogit/objects/"+hash, relativePath)
+// MergeBranch merges x, the commit of the branch xName, into y, the commit of
+// the current branch. The branch is only moved to x when y is before it,
+// unless noFF is set or untracked files would be overwritten, and nothing is
+// merged when x is before y. With ffOnly the merge is refused if it can't be
+// fast-forwarded. The working directory must be clean
+func MergeBranch(x, y *Commit, xName, yName string, noFF, ffOnly bool, options MergeOptions) bool {
+	if IsAncestor(x, y) {
+		fmt.Println("Already up to date")
+		return true
+	}
+	if IsAncestor(y, x) && !noFF && options.Strategy != StrategyOurs {
+		if !CheckUntracked(UntrackedOverwritten(x), "merge") {
+			return false
 		}
+		fmt.Println("Fast-forward")
+		LogDiffStat(DiffCommits(y, x))
+		ApplyCommit(x)
+		SaveHead(x)
+		return true
+	}
+	if ffOnly {
+		fmt.Println("Not possible to fast-forward, aborting")
+		return false
 	}
+	return StartMerge(x, y, xName, yName, true, options)
 }
 
-func ResolveConflicts(base, hash1, hash2 string) string {
-	b, err := ioutil.ReadFile(".gogit/objects/" + base)
-	if err != nil {
-		panic(err)
+// ContinueMerge creates the merge commit once all the conflicts are resolved.
+// A merge that isn't committed is only marked as done
+func ContinueMerge() bool {
+	state := GetMergeState()
+	if state == nil {
+		fmt.Println("No merge in progress")
+		return false
 	}
-	linesBase := strings.Split(string(b), "\n")
-
-	f1, err := ioutil.ReadFile(".gogit/objects/" + hash1)
-	if err != nil {
-		panic(err)
+	if HasConflicts() {
+		fmt.Println("Cannot continue the merge with unresolved conflicts in:")
+		LogConflicts()
+		return false
 	}
-	lines1 := strings.Split(string(f1), "\n")
-
-	f2, err := ioutil.ReadFile(".gogit/objects/" + hash2)
-	if err != nil {
-		panic(err)
+	if state.Message == "" {
+		ClearMergeState()
+		fmt.Println("Merge done, the merged files are left uncommitted")
+		return true
 	}
-	lines2 := strings.Split(string(f2), "\n")
-
-	lx := LCS(linesBase, lines1)
-	ly := LCS(linesBase, lines2)
+	parents := []*Commit{GetCommit(state.Ours), GetCommit(state.Theirs)}
+	newCommit := CreateCommit("user", state.Message, parents)
+	if newCommit == nil {
+		return false
+	}
+	RecordCommit(newCommit)
+	ClearMergeState()
+	return true
+}
 
-	lxy := LCS(lx, ly)
+// AbortMerge restores the files of HEAD from before the merge
+func AbortMerge() {
+	state := GetMergeState()
+	if state == nil && HasConflicts() {
+		fmt.Println("No merge in progress, the conflicts are from applying a stash, use reset --hard to go back to HEAD")
+		return
+	}
+	if state == nil {
+		fmt.Println("No merge in progress")
+		return
+	}
+	if head := GetCommit(state.Head); head != nil {
+		ResetHard(head)
+	} else {
+		ApplyMerge(map[string]string{}, nil)
+	}
+	ClearMergeState()
+}
 
-	lxLineNums := make([]int, len(lx))
-	for i := range lxLineNums {
-		lxLineNums[i] = -1
+// ApplyMerge sets the index and the tracked files of the working directory to
+// the objects (relative path -> hash) with their modes (relative path ->
+// mode). Only the files that differ are written or removed, untracked files
+// are kept
+func ApplyMerge(objects map[string]string, modes map[string]string) {
+	tracked := TrackedPaths(GetIndex())
+	for relativePath := range objects {
+		tracked[relativePath] = true
+	}
+	workingObjects := map[string]string{}
+	allObjects, workingModes := WorkingTreeObjects(tracked)
+	for relativePath, hash := range allObjects {
+		if tracked[relativePath] {
+			workingObjects[relativePath] = hash
+		}
 	}
+	WriteChanges(DiffMaps(workingObjects, objects, workingModes, modes))
+	SaveIndexFromMap(objects, modes)
+}
 
-	lyLineNums := make([]int, len(ly))
-	for i := range lyLineNums {
-		lyLineNums[i] = -1
+// ResolveConflicts merges the changes of ours and theirs to base line by line.
+// It returns the merged content and false if some changes overlap, in which
+// case the content contains conflict markers
+func ResolveConflicts(base, ours, theirs string, labels diff.Labels, favor diff.Favor) (string, bool) {
+	var linesBase []string
+	if base != "" {
+		linesBase = SplitLines(string(ReadBlob(base)))
 	}
+	lines1 := SplitLines(string(ReadBlob(ours)))
+	lines2 := SplitLines(string(ReadBlob(theirs)))
+
+	merged, conflicts := diff.Merge3(linesBase, lines1, lines2, labels, favor)
+	return strings.Join(merged, ""), conflicts == 0
+}
 
-	i1 := 0
-	for i, line := range lxy {
-		for i1 < len(lx) && lx[i1] != line {
-			i1++
+// Ancestors returns c and all the commits before it by hash
+func Ancestors(c *Commit) map[string]*Commit {
+	ancestors := map[string]*Commit{}
+	stack := []*Commit{c}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := ancestors[cur.Hash]; ok {
+			continue
 		}
-		lxLineNums[i1] = i
+		ancestors[cur.Hash] = cur
+		stack = append(stack, cur.PrevCommits...)
 	}
+	return ancestors
+}
 
-	i2 := 0
-	for i, line := range lxy {
-		for i2 < len(ly) && ly[i2] != line {
-			i2++
-		}
-		lyLineNums[i2] = i
-	}
-
-	xAdditions := []struct {
-		Line    string
-		LineNum int
-	}{}
-	yAdditions := []struct {
-		Line    string
-		LineNum int
-	}{}
-
-	i1 = 0
-	for i, line := range lx {
-		for i1 < len(lines1) && lines1[i1] != line {
-			xAdditions = append(xAdditions, struct {
-				Line    string
-				LineNum int
-			}{Line: lines1[i1], LineNum: i - 1})
-			i1++
+// IsAncestor returns true if a is b or one of the commits before it
+func IsAncestor(a, b *Commit) bool {
+	_, ok := Ancestors(b)[a.Hash]
+	return ok
+}
+
+// MergeBases returns the best common ancestors of x and y, the common
+// ancestors that aren't before another common ancestor, newest first
+func MergeBases(x, y *Commit) []*Commit {
+	xAncestors := Ancestors(x)
+	var common []*Commit
+	for hash, c := range Ancestors(y) {
+		if _, ok := xAncestors[hash]; ok {
+			common = append(common, c)
 		}
-		i1++
-	}
-	for i1 < len(lines1) {
-		xAdditions = append(xAdditions, struct {
-			Line    string
-			LineNum int
-		}{Line: lines1[i1], LineNum: len(lx) - 1})
-		i1++
-	}
-
-	i2 = 0
-	for i, line := range ly {
-		for i2 < len(lines2) && lines2[i2] != line {
-			yAdditions = append(yAdditions, struct {
-				Line    string
-				LineNum int
-			}{Line: lines2[i2], LineNum: i - 1})
-			i2++
+	}
+	sort.Slice(common, func(i, j int) bool {
+		if common[i].Time != common[j].Time {
+			return common[i].Time > common[j].Time
 		}
-		i2++
-	}
-	for i2 < len(lines2) {
-		yAdditions = append(yAdditions, struct {
-			Line    string
-			LineNum int
-		}{Line: lines2[i2], LineNum: len(ly) - 1})
-		i2++
-	}
-
-	finalLines := []string{}
-	i1 = 0
-	i2 = 0
-	for i, line := range lxy {
-		for i1 < len(xAdditions) && xAdditions[i1].LineNum < i {
-			finalLines = append(finalLines, xAdditions[i1].Line)
-			i1++
+		return common[i].Hash < common[j].Hash
+	})
+
+	// mark everything before a common ancestor, the walk stops at commits
+	// already marked as their ancestors are marked too
+	before := map[string]bool{}
+	for _, c := range common {
+		if before[c.Hash] {
+			continue
 		}
-		for i2 < len(yAdditions) && yAdditions[i2].LineNum < i {
-			finalLines = append(finalLines, yAdditions[i2].Line)
-			i2++
+		stack := append([]*Commit{}, c.PrevCommits...)
+		for len(stack) > 0 {
+			cur := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if before[cur.Hash] {
+				continue
+			}
+			before[cur.Hash] = true
+			stack = append(stack, cur.PrevCommits...)
 		}
-		finalLines = append(finalLines, line)
-	}
-	for i1 < len(xAdditions) {
-		finalLines = append(finalLines, xAdditions[i1].Line)
-		i1++
-	}
-	for i2 < len(yAdditions) {
-		finalLines = append(finalLines, yAdditions[i2].Line)
-		i2++
 	}
 
-	finalStringContent := strings.Join(finalLines, "\n")
-	return finalStringContent
+	var bases []*Commit
+	for _, c := range common {
+		if !before[c.Hash] {
+			bases = append(bases, c)
+		}
+	}
+	return bases
 }
 
-func LCA(x, y *Commit) *Commit {
-	visX := map[string]bool{}
-	visY := map[string]bool{}
-
-	queueX := []*Commit{x}
-	queueY := []*Commit{y}
-
-	for len(queueX) > 0 || len(queueY) > 0 {
-		if len(queueX) > 0 {
-			curX := queueX[0]
-			queueX = queueX[1:]
-			if visY[curX.Hash] {
-				return curX
-			}
-			visX[curX.Hash] = true
-			queueX = append(queueX, curX.PrevCommits...)
+// MergeBase returns the commit to use as the base of a merge of x and y. When
+// there are several best common ancestors (after criss-cross merges) they are
+// merged one after the other into a virtual commit, which isn't saved, using
+// their own merge base recursively. Conflicts in these merges are kept with
+// their markers. It returns nil if x and y have no common ancestor
+func MergeBase(x, y *Commit) *Commit {
+	bases := MergeBases(x, y)
+	if len(bases) == 0 {
+		return nil
+	}
+	base := bases[0]
+	for _, other := range bases[1:] {
+		baseTree := ""
+		if inner := MergeBase(base, other); inner != nil {
+			baseTree = inner.Tree
 		}
-
-		if len(queueY) > 0 {
-			curY := queueY[0]
-			queueY = queueY[1:]
-			if visX[curY.Hash] {
-				return curY
-			}
-			visY[curY.Hash] = true
-			queueY = append(queueY, curY.PrevCommits...)
+		labels := diff.Labels{Ours: "Temporary merge branch 1", Base: "base", Theirs: "Temporary merge branch 2"}
+		objects, _, conflictContents := MergeTrees(baseTree, base.Tree, other.Tree, labels, diff.FavorNone, true)
+		for relativePath, content := range conflictContents {
+			objects[relativePath] = WriteObject(BlobObject, []byte(content))
+		}
+		modes := MergeModes(baseTree, base.Tree, other.Tree, objects)
+		var treeObjects []Object
+		for relativePath, hash := range objects {
+			treeObjects = append(treeObjects, Object{hash, relativePath, ModeOf(modes, relativePath)})
 		}
+		virtual := &Commit{
+			User:        "user",
+			Tree:        BuildTree(treeObjects),
+			PrevCommits: []*Commit{base, other},
+			Time:        base.Time,
+			Message:     "merged common ancestors",
+		}
+		virtual.Hash = HashCommit(virtual.Tree, virtual.PrevCommits, virtual.Message, virtual.Time)
+		base = virtual
 	}
-
-	return nil
+	return base
 }
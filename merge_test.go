@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+// setupDiverged makes MASTER and feat diverge from a common commit, feat
+// adding new.txt
+func setupDiverged(t *testing.T) {
+	t.Helper()
+	newTestRepo(t)
+	commitFile(t, "a.txt", "base\n", "base")
+	gogit(t, "branch", "create", "feat")
+	commitFile(t, "new.txt", "new\n", "add new.txt")
+	gogit(t, "cb", "MASTER")
+	commitFile(t, "a.txt", "master\n", "change a.txt")
+}
+
+func TestMergeBranchKeepsUntrackedFiles(t *testing.T) {
+	setupDiverged(t)
+	writeFile(t, "new.txt", "MY PRECIOUS UNTRACKED\n")
+	head := GetHead()
+
+	gogit(t, "mb", "feat")
+
+	checkUntouched(t, "new.txt", "MY PRECIOUS UNTRACKED\n", head)
+	if GetMergeState() != nil || HasConflicts() {
+		t.Error("a refused merge left a merge in progress")
+	}
+	if got := readFile(t, "a.txt"); got != "master\n" {
+		t.Errorf("a.txt was changed to %q", got)
+	}
+}
+
+func TestFastForwardKeepsUntrackedFiles(t *testing.T) {
+	newTestRepo(t)
+	commitFile(t, "a.txt", "base\n", "base")
+	gogit(t, "branch", "create", "feat")
+	commitFile(t, "new.txt", "new\n", "add new.txt")
+	gogit(t, "cb", "MASTER")
+	writeFile(t, "new.txt", "MY PRECIOUS UNTRACKED\n")
+	head := GetHead()
+
+	gogit(t, "mb", "feat")
+
+	checkUntouched(t, "new.txt", "MY PRECIOUS UNTRACKED\n", head)
+}
+
+func TestMergeBranch(t *testing.T) {
+	setupDiverged(t)
+
+	gogit(t, "mb", "feat")
+
+	head := GetCommit(GetHead())
+	if len(head.PrevCommits) != 2 {
+		t.Fatalf("HEAD has %d parents, want a merge commit", len(head.PrevCommits))
+	}
+	if got := readFile(t, "new.txt"); got != "new\n" {
+		t.Errorf("new.txt is %q after the merge", got)
+	}
+	if got := readFile(t, "a.txt"); got != "master\n" {
+		t.Errorf("a.txt is %q after the merge", got)
+	}
+}
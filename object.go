@@ -2,22 +2,70 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
+// File modes of the index and the trees. Regular files are serialized without their mode so
+// that trees and indexes written before modes were recorded are unchanged
+const (
+	RegularMode    = "100644"
+	ExecutableMode = "100755"
+	SymlinkMode    = "120000" // the content of the blob is the target
+	DirMode        = "040000" // an empty directory kept explicitly, its hash is EmptyTreeHash
+)
+
 type Object struct {
 	Hash         string
 	RelativePath string
+	Mode         string // RegularMode, ExecutableMode, SymlinkMode or DirMode
 }
 
 func (o *Object) Serialize() string {
-	return fmt.Sprintf("%s|%s", o.Hash, o.RelativePath)
+	return fmt.Sprintf("%s|%s", withMode(o.Hash, o.Mode), o.RelativePath)
 }
 
 func DeserializeObject(s string) *Object {
-	var hash, relativePath string
-	strs := strings.Split(s, "|")
-	hash = strs[0]
-	relativePath = strs[1]
-	return &Object{hash, relativePath}
+	strs := strings.SplitN(s, "|", 2)
+	hash, mode := splitMode(strs[0])
+	return &Object{hash, strs[1], mode}
+}
+
+// withMode appends ":<mode>" to a serialized field unless the mode is regular
+func withMode(field string, mode string) string {
+	if mode == "" || mode == RegularMode {
+		return field
+	}
+	return field + ":" + mode
+}
+
+// splitMode returns a field serialized by withMode and its mode
+func splitMode(field string) (string, string) {
+	if i := strings.IndexByte(field, ':'); i != -1 {
+		return field[:i], field[i+1:]
+	}
+	return field, RegularMode
+}
+
+// FileModeOf returns the mode of a file of the working directory
+func FileModeOf(info os.FileInfo) string {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return SymlinkMode
+	}
+	if info.IsDir() {
+		return DirMode
+	}
+	if info.Mode()&0111 != 0 {
+		return ExecutableMode
+	}
+	return RegularMode
+}
+
+// ModeOf returns the mode of a file in modes (relative path -> mode), files
+// that aren't in it are regular
+func ModeOf(modes map[string]string, relativePath string) string {
+	if mode, ok := modes[relativePath]; ok && mode != "" {
+		return mode
+	}
+	return RegularMode
 }
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+	Packs bundle many objects into .gogit/packs/pack-<hash>.pack with an index
+	in .gogit/packs/pack-<hash>.idx:
+
+	- The pack starts with the magic string "GOGITPACK" and a version byte,
+	  followed by the objects encoded the same way as loose objects
+	- The index has one "<hash> <offset> <length>" line per object
+	- Similar blobs are stored as "delta" objects whose content is
+	  "<type> <base hash>\n" followed by the instructions to rebuild the
+	  object from its base (see MakeDelta)
+*/
+
+const (
+	PackMagic   = "GOGITPACK"
+	PackVersion = 1
+
+	DeltaObject = "delta"
+
+	deltaBlockSize = 16 // size of the blocks indexed when searching for matches
+	deltaWindow    = 10 // number of objects tried as a base for each object
+	deltaMaxDepth  = 10 // maximum length of a chain of deltas
+
+	deltaCopy   = 0
+	deltaInsert = 1
+)
+
+type PackEntry struct {
+	Offset int64
+	Length int64
+}
+
+type Pack struct {
+	Path    string               // Path of the .pack file
+	Entries map[string]PackEntry // Object hash -> position in the pack
+}
+
+var loadedPacks []*Pack
+
+func GetPacks() []*Pack {
+	if loadedPacks != nil {
+		return loadedPacks
+	}
+	loadedPacks = []*Pack{}
+	indexes, err := filepath.Glob(".gogit/packs/*.idx")
+	if err != nil {
+		panic(err)
+	}
+	for _, index := range indexes {
+		loadedPacks = append(loadedPacks, LoadPack(index))
+	}
+	return loadedPacks
+}
+
+func LoadPack(indexPath string) *Pack {
+	b, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		panic(err)
+	}
+	pack := &Pack{strings.TrimSuffix(indexPath, ".idx") + ".pack", map[string]PackEntry{}}
+	for _, line := range strings.Split(string(b), "\n") {
+		var hash string
+		var entry PackEntry
+		n, _ := fmt.Sscanf(line, "%s %d %d", &hash, &entry.Offset, &entry.Length)
+		if n == 3 {
+			pack.Entries[hash] = entry
+		}
+	}
+	return pack
+}
+
+func IsPacked(hash string) bool {
+	for _, pack := range GetPacks() {
+		if _, ok := pack.Entries[hash]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadPackedObject returns the object from the first pack containing it
+func ReadPackedObject(hash string) (string, []byte, bool) {
+	for _, pack := range GetPacks() {
+		if _, ok := pack.Entries[hash]; ok {
+			objType, content := pack.Read(hash)
+			return objType, content, true
+		}
+	}
+	return "", nil, false
+}
+
+func (p *Pack) Read(hash string) (string, []byte) {
+	entry := p.Entries[hash]
+	f, err := os.Open(p.Path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	b := make([]byte, entry.Length)
+	_, err = f.ReadAt(b, entry.Offset)
+	if err != nil {
+		panic(err)
+	}
+	objType, content := DecodeObject(b)
+	if objType != DeltaObject {
+		return objType, content
+	}
+
+	i := bytes.IndexByte(content, '\n')
+	var baseHash string
+	fmt.Sscanf(string(content[:i]), "%s %s", &objType, &baseHash)
+	_, base := ReadObject(baseHash)
+	return objType, ApplyDelta(base, content[i+1:])
+}
+
+// Repack moves loose objects into a new pack. If all is set, the objects of
+// the existing packs are also moved and the old packs are removed
+func Repack(all bool) (int, int) {
+	var hashes []string
+	files, err := os.ReadDir(".gogit/objects")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		if !file.IsDir() && !strings.HasSuffix(file.Name(), ".tmp") {
+			hashes = append(hashes, file.Name())
+		}
+	}
+	oldPacks := []*Pack{}
+	if all {
+		oldPacks = GetPacks()
+		for _, pack := range oldPacks {
+			for hash := range pack.Entries {
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	if len(hashes) == 0 {
+		return 0, 0
+	}
+
+	type packObject struct {
+		Hash    string
+		Type    string
+		Content []byte
+		Base    string
+		Delta   []byte
+		Depth   int
+	}
+	seen := map[string]bool{}
+	var objects []*packObject
+	for _, hash := range hashes {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		objType, content := ReadObject(hash)
+		objects = append(objects, &packObject{Hash: hash, Type: objType, Content: content})
+	}
+
+	// similar files usually have similar sizes, so try the neighbouring
+	// objects of the same type as bases
+	sort.SliceStable(objects, func(i, j int) bool {
+		if objects[i].Type != objects[j].Type {
+			return objects[i].Type < objects[j].Type
+		}
+		return len(objects[i].Content) > len(objects[j].Content)
+	})
+	deltas := 0
+	for i, object := range objects {
+		if object.Type != BlobObject {
+			continue
+		}
+		for j := i - 1; j >= 0 && j >= i-deltaWindow; j-- {
+			base := objects[j]
+			if base.Type != object.Type || base.Depth >= deltaMaxDepth {
+				continue
+			}
+			delta := MakeDelta(base.Content, object.Content)
+			if len(delta) < len(object.Content)/2 && (object.Delta == nil || len(delta) < len(object.Delta)) {
+				object.Base = base.Hash
+				object.Delta = delta
+				object.Depth = base.Depth + 1
+			}
+		}
+		if object.Delta != nil {
+			deltas++
+		}
+	}
+
+	var pack bytes.Buffer
+	var index strings.Builder
+	pack.WriteString(PackMagic)
+	pack.WriteByte(PackVersion)
+	for _, object := range objects {
+		var b []byte
+		if object.Delta != nil {
+			header := fmt.Sprintf("%s %s\n", object.Type, object.Base)
+			b = EncodeObject(DeltaObject, append([]byte(header), object.Delta...))
+		} else {
+			b = EncodeObject(object.Type, object.Content)
+		}
+		fmt.Fprintf(&index, "%s %d %d\n", object.Hash, pack.Len(), len(b))
+		pack.Write(b)
+	}
+
+	err = os.MkdirAll(".gogit/packs", 0755)
+	if err != nil {
+		panic(err)
+	}
+	name := ".gogit/packs/pack-" + HashContent([]byte(index.String()))
+	err = ioutil.WriteFile(name+".pack", pack.Bytes(), 0644)
+	if err != nil {
+		panic(err)
+	}
+	// the index is written last so readers never see a partial pack
+	err = ioutil.WriteFile(name+".idx", []byte(index.String()), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, pack := range oldPacks {
+		if pack.Path == name+".pack" {
+			continue
+		}
+		os.Remove(strings.TrimSuffix(pack.Path, ".pack") + ".idx")
+		os.Remove(pack.Path)
+	}
+	for _, file := range files {
+		if seen[file.Name()] {
+			os.Remove(filepath.Join(".gogit/objects", file.Name()))
+		}
+	}
+	loadedPacks = nil
+	return len(objects), deltas
+}
+
+// MakeDelta returns the instructions to build target from base: the sizes of
+// both as uvarints followed by copy (offset, length) and insert (length,
+// data) instructions
+func MakeDelta(base, target []byte) []byte {
+	blocks := map[string]int{} // block -> offset in base
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		block := string(base[i : i+deltaBlockSize])
+		if _, ok := blocks[block]; !ok {
+			blocks[block] = i
+		}
+	}
+
+	var delta []byte
+	delta = appendUvarint(delta, uint64(len(base)))
+	delta = appendUvarint(delta, uint64(len(target)))
+	insertStart := 0
+	flushInsert := func(end int) {
+		if end > insertStart {
+			delta = append(delta, deltaInsert)
+			delta = appendUvarint(delta, uint64(end-insertStart))
+			delta = append(delta, target[insertStart:end]...)
+		}
+	}
+
+	i := 0
+	for i+deltaBlockSize <= len(target) {
+		offset, ok := blocks[string(target[i:i+deltaBlockSize])]
+		if !ok {
+			i++
+			continue
+		}
+		// extend the match in both directions
+		start, baseStart := i, offset
+		for start > insertStart && baseStart > 0 && target[start-1] == base[baseStart-1] {
+			start--
+			baseStart--
+		}
+		end, baseEnd := i+deltaBlockSize, offset+deltaBlockSize
+		for end < len(target) && baseEnd < len(base) && target[end] == base[baseEnd] {
+			end++
+			baseEnd++
+		}
+		flushInsert(start)
+		delta = append(delta, deltaCopy)
+		delta = appendUvarint(delta, uint64(baseStart))
+		delta = appendUvarint(delta, uint64(end-start))
+		i = end
+		insertStart = end
+	}
+	flushInsert(len(target))
+	return delta
+}
+
+func appendUvarint(b []byte, n uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutUvarint(buf, n)]...)
+}
+
+func ApplyDelta(base, delta []byte) []byte {
+	r := bytes.NewReader(delta)
+	readUvarint := func() int {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			panic(err)
+		}
+		return int(n)
+	}
+	if readUvarint() != len(base) {
+		panic("Delta base size mismatch")
+	}
+	target := make([]byte, 0, readUvarint())
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		switch op {
+		case deltaCopy:
+			offset := readUvarint()
+			length := readUvarint()
+			target = append(target, base[offset:offset+length]...)
+		case deltaInsert:
+			data := make([]byte, readUvarint())
+			_, err := io.ReadFull(r, data)
+			if err != nil {
+				panic(err)
+			}
+			target = append(target, data...)
+		default:
+			panic("Invalid delta instruction " + strconv.Itoa(int(op)))
+		}
+	}
+	if len(target) != cap(target) {
+		panic("Delta target size mismatch")
+	}
+	return target
+}
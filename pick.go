@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+)
+
+/*
+	Cherry-pick applies the changes a commit made to its first parent on top
+	of HEAD and revert applies the inverse changes, both with the same
+	three-way merge as rebase. Every commit is committed on the current branch
+	right away. On conflicts the commands stop until they are continued or
+	aborted, the list of commits left is kept in .gogit/PICK_STATE.
+*/
+
+// StartPick cherry-picks or reverts (action is "pick" or "revert") the
+// commits one after the other
+func StartPick(commits []*Commit, action string) bool {
+	state := &PickState{Head: GetHead()}
+	for _, c := range commits {
+		if len(c.PrevCommits) > 1 {
+			fmt.Printf("Commit %s is a merge commit, it can't be applied\n", ShortHash(c.Hash))
+			return false
+		}
+		state.Todo = append(state.Todo, RebaseStep{action, c.Hash})
+	}
+	return RunPick(state)
+}
+
+// RunPick applies the commits left. It returns false if it stopped on
+// conflicts
+func RunPick(state *PickState) bool {
+	for len(state.Todo) != 0 {
+		state.Current = state.Todo[0]
+		state.Todo = state.Todo[1:]
+		SavePickState(state)
+
+		c := GetCommit(state.Current.Hash)
+		revert := state.Current.Action == "revert"
+		command := "cherry-pick"
+		if revert {
+			command = "revert"
+		}
+		clean, ok := ReplayCommit(c, revert, command)
+		if !ok {
+			// the commit is applied again when continuing, nothing is
+			// left behind if nothing was committed yet
+			if state.Head == GetHead() {
+				ClearPickState()
+				return false
+			}
+			state.Todo = append([]RebaseStep{state.Current}, state.Todo...)
+			state.Current = RebaseStep{}
+			SavePickState(state)
+			fmt.Printf("Then run %s --continue, or use %s --abort\n", command, command)
+			return false
+		}
+		if !clean {
+			fmt.Printf("Could not apply %s %s\n", ShortHash(c.Hash), c.Subject())
+			fmt.Printf("Fix the conflicts, add the files and run %s --continue, or use %s --abort\n", command, command)
+			return false
+		}
+		commitPick(state.Current)
+		state.Current = RebaseStep{}
+	}
+	ClearPickState()
+	return true
+}
+
+// commitPick commits the index on the current branch with a message that
+// refers to the commit of the step
+func commitPick(step RebaseStep) {
+	c := GetCommit(step.Hash)
+	head := GetCommit(GetHead())
+	if BuildTree(IndexObjects(GetIndex())) == head.Tree {
+		fmt.Printf("Nothing to commit, the changes of %s are already applied\n", ShortHash(c.Hash))
+		return
+	}
+	user := c.User
+	message := c.Message + "\n\n(cherry picked from commit " + c.Hash + ")"
+	if step.Action == "revert" {
+		user = "user"
+		message = "Revert \"" + c.Subject() + "\"\n\nThis reverts commit " + c.Hash + "."
+	}
+	newCommit := CreateCommit(user, message, []*Commit{head})
+	if newCommit != nil {
+		RecordCommit(newCommit)
+		fmt.Printf("[%s] %s\n", ShortHash(newCommit.Hash), newCommit.Subject())
+	}
+}
+
+// ContinuePick commits the resolved conflicts and applies the commits left
+func ContinuePick() bool {
+	state := GetPickState()
+	if state == nil {
+		fmt.Println("No cherry-pick or revert in progress")
+		return false
+	}
+	if HasConflicts() {
+		fmt.Println("Cannot continue with unresolved conflicts in:")
+		LogConflicts()
+		return false
+	}
+	if !CheckUnstaged("cherry-pick or revert") {
+		return false
+	}
+	if state.Current.Hash != "" {
+		commitPick(state.Current)
+		state.Current = RebaseStep{}
+	}
+	return RunPick(state)
+}
+
+// AbortPick restores HEAD, its branch and the files from before the first
+// commit was applied
+func AbortPick() {
+	state := GetPickState()
+	if state == nil {
+		fmt.Println("No cherry-pick or revert in progress")
+		return
+	}
+	head := GetCommit(state.Head)
+	ResetHard(head)
+	SaveHead(head)
+	ClearPickState()
+}
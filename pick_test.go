@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestCherryPickKeepsUntrackedFiles(t *testing.T) {
+	setupDiverged(t)
+	writeFile(t, "new.txt", "PRECIOUS\n")
+	head := GetHead()
+
+	gogit(t, "cherry-pick", "feat")
+
+	checkUntouched(t, "new.txt", "PRECIOUS\n", head)
+	if GetPickState() != nil {
+		t.Error("a refused cherry-pick left a cherry-pick in progress")
+	}
+}
+
+func TestCherryPick(t *testing.T) {
+	setupDiverged(t)
+
+	gogit(t, "cherry-pick", "feat")
+
+	head := GetCommit(GetHead())
+	if head.Subject() != "add new.txt" || len(head.PrevCommits) != 1 {
+		t.Errorf("HEAD is %q with %d parents after the cherry-pick", head.Message, len(head.PrevCommits))
+	}
+	if got := readFile(t, "new.txt"); got != "new\n" {
+		t.Errorf("new.txt is %q after the cherry-pick", got)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gogit/diff"
+)
+
+/*
+	Rebase replays the commits of the current branch that aren't in upstream
+	on top of it, oldest first:
+
+	- HEAD is detached at upstream and the list of commits to replay is saved
+	  in .gogit/REBASE_STATE
+	- Every commit is replayed with a three-way merge of its parent (base),
+	  HEAD (ours) and the commit (theirs) and committed on top of HEAD with
+	  the author and time of the original commit. Commits whose changes are
+	  already in HEAD are dropped
+	- On conflicts the rebase stops until it is continued, skipped or aborted
+	- The branch is moved to the last replayed commit once all of them are
+	  done, so an aborted rebase leaves it where it was
+
+	Merge commits are not replayed. An interactive rebase lets the user edit
+	the list of commits first to reorder, reword, edit, squash, fixup or drop
+	them.
+*/
+
+// StartRebase replays the commits of the current branch that aren't in
+// upstream on top of it. If interactive is set, the todo list is edited first
+func StartRebase(upstream *Commit, interactive bool) bool {
+	branch := GetHeadBranch()
+	head := GetCommit(GetHead())
+	if branch == "" || head == nil {
+		fmt.Println("Not on a branch")
+		return false
+	}
+	if IsAncestor(upstream, head) && !interactive {
+		fmt.Printf("Current branch %s is up to date\n", branch)
+		return true
+	}
+
+	if !CheckUntracked(UntrackedOverwritten(upstream), "rebase") {
+		return false
+	}
+
+	state := &RebaseState{Branch: branch, OrigHead: head.Hash, Onto: upstream.Hash}
+	for _, c := range CommitsToReplay(upstream, head) {
+		state.Todo = append(state.Todo, RebaseStep{"pick", c.Hash})
+	}
+	if interactive {
+		todo, ok := EditTodo(state.Todo)
+		if !ok {
+			return false
+		}
+		if len(todo) == 0 {
+			fmt.Println("Nothing to do")
+			return false
+		}
+		state.Todo = todo
+	}
+	SaveRebaseState(state)
+	ApplyCommit(upstream)
+	DetachHead(upstream)
+	return RunRebase(state)
+}
+
+// CommitsToReplay returns the commits before head, head included, that
+// aren't before upstream, parents first. Merge commits are left out
+func CommitsToReplay(upstream, head *Commit) []*Commit {
+	upstreamAncestors := Ancestors(upstream)
+	visited := map[string]bool{}
+	var commits []*Commit
+	var visit func(c *Commit)
+	visit = func(c *Commit) {
+		if _, ok := upstreamAncestors[c.Hash]; ok || visited[c.Hash] {
+			return
+		}
+		visited[c.Hash] = true
+		for _, parent := range c.PrevCommits {
+			visit(parent)
+		}
+		if len(c.PrevCommits) <= 1 {
+			commits = append(commits, c)
+		}
+	}
+	visit(head)
+	return commits
+}
+
+// RunRebase does the steps left in the todo list of the rebase. It returns
+// false if it stopped on conflicts, untracked files or to edit a commit
+func RunRebase(state *RebaseState) bool {
+	for len(state.Todo) != 0 {
+		state.Current = state.Todo[0]
+		state.Todo = state.Todo[1:]
+		SaveRebaseState(state)
+
+		c := GetCommit(state.Current.Hash)
+		clean, ok := ReplayCommit(c, false, "rebase")
+		if !ok {
+			// the commit is replayed again when continuing
+			state.Todo = append([]RebaseStep{state.Current}, state.Todo...)
+			state.Current = RebaseStep{}
+			SaveRebaseState(state)
+			fmt.Println("Then run rebase --continue, or use rebase --abort")
+			return false
+		}
+		if !clean {
+			fmt.Printf("Could not apply %s %s\n", ShortHash(c.Hash), c.Subject())
+			fmt.Println("Fix the conflicts, add the files and run rebase --continue, or use rebase --skip or --abort")
+			return false
+		}
+		if !finishStep(state, c) {
+			return false
+		}
+	}
+	CreateBranch(state.Branch, GetHead())
+	SaveHeadBranch(state.Branch)
+	ClearRebaseState()
+	fmt.Printf("Successfully rebased and updated %s\n", state.Branch)
+	return true
+}
+
+// ReplayCommit applies the changes c made to its first parent on top of HEAD
+// to the working directory and the index, or the inverse changes if revert is
+// set. clean is false if there are conflicts, ok is false if nothing was
+// applied because untracked files are in the way of the command
+func ReplayCommit(c *Commit, revert bool, command string) (clean bool, ok bool) {
+	head := GetCommit(GetHead())
+	parentTree := ""
+	if len(c.PrevCommits) != 0 {
+		parentTree = c.PrevCommits[0].Tree
+	}
+	commitName := ShortHash(c.Hash) + " (" + c.Subject() + ")"
+	labels := diff.Labels{Ours: "HEAD", Base: "parent of " + commitName, Theirs: commitName}
+	baseTree, theirsTree := parentTree, c.Tree
+	if revert {
+		labels.Base, labels.Theirs = commitName, "parent of "+commitName
+		baseTree, theirsTree = c.Tree, parentTree
+	}
+	objects, conflicts, conflictContents := MergeTrees(baseTree, head.Tree, theirsTree, labels, diff.FavorNone, false)
+	modes := MergeModes(baseTree, head.Tree, theirsTree, objects)
+	if !ApplyMergeResult(objects, modes, conflicts, conflictContents, "HEAD", ShortHash(c.Hash), command) {
+		return false, false
+	}
+	return len(conflicts) == 0, true
+}
+
+// finishStep commits the replayed changes of c as the current step of the
+// rebase asks. It returns false if the rebase stops to edit the commit
+func finishStep(state *RebaseState, c *Commit) bool {
+	switch state.Current.Action {
+	case "squash", "fixup":
+		head := GetCommit(GetHead())
+		message := head.Message
+		if state.Current.Action == "squash" {
+			message = EditMessage(head.Message+"\n\n"+c.Message, []string{"This is the combination of the messages of 2 commits."})
+		}
+		amendHead(message)
+	case "edit":
+		commitPicked(c)
+		state.Current = RebaseStep{"amend", c.Hash}
+		SaveRebaseState(state)
+		fmt.Printf("Stopped at %s %s\n", ShortHash(c.Hash), c.Subject())
+		fmt.Println("Make your changes, add them and run rebase --continue to amend the commit")
+		return false
+	default:
+		if commitPicked(c) && state.Current.Action == "reword" {
+			amendHead(EditMessage(c.Message, []string{"Rewording " + ShortHash(c.Hash) + "."}))
+		}
+	}
+	state.Current = RebaseStep{}
+	return true
+}
+
+// commitPicked commits the index on top of HEAD with the author, time and
+// message of c. The commit is dropped if it doesn't change anything
+func commitPicked(c *Commit) bool {
+	head := GetCommit(GetHead())
+	if BuildTree(IndexObjects(GetIndex())) == head.Tree {
+		fmt.Printf("Dropping %s %s, its changes are already applied\n", ShortHash(c.Hash), c.Subject())
+		return false
+	}
+	newCommit := CreateCommitAt(c.User, c.Message, []*Commit{head}, c.Time)
+	if newCommit == nil {
+		return false
+	}
+	RecordCommit(newCommit)
+	return true
+}
+
+// amendHead replaces HEAD with a commit of the index with the message. The
+// commit is kept when the changes cancel out with the ones of its parent, like
+// a fixup reverting the commit it fixes, so the message isn't lost
+func amendHead(message string) {
+	head := GetCommit(GetHead())
+	amended := Commit{
+		User:        head.User,
+		Tree:        BuildTree(IndexObjects(GetIndex())),
+		PrevCommits: head.PrevCommits,
+		Time:        head.Time,
+		Message:     message,
+	}
+	amended.Hash = HashCommit(amended.Tree, amended.PrevCommits, amended.Message, amended.Time)
+	SaveCommit(&amended)
+	RecordCommit(&amended)
+}
+
+// EditTodo lets the user edit the todo list of an interactive rebase
+func EditTodo(steps []RebaseStep) ([]RebaseStep, bool) {
+	var content string
+	for _, step := range steps {
+		content += fmt.Sprintf("%s %s %s\n", step.Action, ShortHash(step.Hash), GetCommit(step.Hash).Subject())
+	}
+	comments := []string{
+		"",
+		"Commands:",
+		"p, pick <commit> = use commit",
+		"r, reword <commit> = use commit, but edit the commit message",
+		"e, edit <commit> = use commit, but stop for amending",
+		"s, squash <commit> = use commit, but meld into previous commit",
+		"f, fixup <commit> = like squash, but discard this commit's message",
+		"d, drop <commit> = remove commit",
+		"",
+		"The lines can be reordered, they are executed from top to bottom.",
+		"Removing a line drops the commit, removing everything aborts the rebase.",
+	}
+	edited, ok := EditFile(".gogit/REBASE_TODO", content+"\n", comments)
+	os.Remove(".gogit/REBASE_TODO")
+	if !ok {
+		return nil, false
+	}
+	return ParseTodo(edited, steps)
+}
+
+// ParseTodo reads an edited todo list. Commits are given by a prefix of the
+// hash of one of the original steps
+func ParseTodo(content string, steps []RebaseStep) ([]RebaseStep, bool) {
+	actions := map[string]string{
+		"p": "pick", "pick": "pick",
+		"r": "reword", "reword": "reword",
+		"e": "edit", "edit": "edit",
+		"s": "squash", "squash": "squash",
+		"f": "fixup", "fixup": "fixup",
+		"d": "drop", "drop": "drop",
+	}
+	var todo []RebaseStep
+	for i, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		action, ok := actions[fields[0]]
+		if !ok {
+			fmt.Printf("Unknown action %s on line %d of the todo list\n", fields[0], i+1)
+			return nil, false
+		}
+		if len(fields) < 2 {
+			fmt.Printf("Missing commit on line %d of the todo list\n", i+1)
+			return nil, false
+		}
+		hash := ""
+		for _, step := range steps {
+			if strings.HasPrefix(step.Hash, fields[1]) {
+				if hash != "" && hash != step.Hash {
+					fmt.Printf("Ambiguous commit %s on line %d of the todo list\n", fields[1], i+1)
+					return nil, false
+				}
+				hash = step.Hash
+			}
+		}
+		if hash == "" {
+			fmt.Printf("Unknown commit %s on line %d of the todo list\n", fields[1], i+1)
+			return nil, false
+		}
+		if action == "drop" {
+			continue
+		}
+		if (action == "squash" || action == "fixup") && len(todo) == 0 {
+			fmt.Printf("Cannot %s without a previous commit on line %d of the todo list\n", action, i+1)
+			return nil, false
+		}
+		todo = append(todo, RebaseStep{action, hash})
+	}
+	return todo, true
+}
+
+// ContinueRebase finishes the step the rebase stopped at, committing the
+// resolved conflicts or amending the edited commit, and does the rest
+func ContinueRebase() bool {
+	state := GetRebaseState()
+	if state == nil {
+		fmt.Println("No rebase in progress")
+		return false
+	}
+	if HasConflicts() {
+		fmt.Println("Cannot continue the rebase with unresolved conflicts in:")
+		LogConflicts()
+		return false
+	}
+	if !CheckUnstaged("rebase") {
+		return false
+	}
+	if state.Current.Action == "amend" {
+		// stopped to edit the commit
+		head := GetCommit(GetHead())
+		if BuildTree(IndexObjects(GetIndex())) != head.Tree {
+			amendHead(head.Message)
+		}
+		state.Current = RebaseStep{}
+	} else if state.Current.Hash != "" && !finishStep(state, GetCommit(state.Current.Hash)) {
+		return false
+	}
+	return RunRebase(state)
+}
+
+// SkipRebase drops the commit the rebase stopped at and replays the rest
+func SkipRebase() bool {
+	state := GetRebaseState()
+	if state == nil {
+		fmt.Println("No rebase in progress")
+		return false
+	}
+	ResetHard(GetCommit(GetHead()))
+	SaveConflicts(nil)
+	state.Current = RebaseStep{}
+	return RunRebase(state)
+}
+
+// AbortRebase restores HEAD and the files from before the rebase
+func AbortRebase() {
+	state := GetRebaseState()
+	if state == nil {
+		fmt.Println("No rebase in progress")
+		return
+	}
+	origHead := GetCommit(state.OrigHead)
+	ResetHard(origHead)
+	SaveHeadBranch(state.Branch)
+	ClearRebaseState()
+}
@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+// setupStoppedRebase rebases feat, which changes a.txt and then adds new.txt,
+// on MASTER, which changes a.txt too, so that it stops on the conflict
+func setupStoppedRebase(t *testing.T) {
+	t.Helper()
+	newTestRepo(t)
+	commitFile(t, "a.txt", "base\n", "base")
+	gogit(t, "branch", "create", "feat")
+	commitFile(t, "a.txt", "feat\n", "change a.txt on feat")
+	commitFile(t, "new.txt", "new\n", "add new.txt")
+	gogit(t, "cb", "MASTER")
+	commitFile(t, "a.txt", "master\n", "change a.txt")
+	gogit(t, "cb", "feat")
+
+	gogit(t, "rebase", "MASTER")
+
+	if GetRebaseState() == nil || !HasConflicts() {
+		t.Fatal("the rebase didn't stop on the conflict")
+	}
+}
+
+func TestRebaseKeepsUntrackedFiles(t *testing.T) {
+	setupStoppedRebase(t)
+	writeFile(t, "a.txt", "resolved\n")
+	gogit(t, "add", "a.txt")
+	writeFile(t, "new.txt", "PRECIOUS\n")
+
+	gogit(t, "rebase", "--continue")
+
+	if got := readFile(t, "new.txt"); got != "PRECIOUS\n" {
+		t.Errorf("untracked new.txt was overwritten with %q", got)
+	}
+	if _, ok := GetIndex()["new.txt"]; ok {
+		t.Error("untracked new.txt was added to the index")
+	}
+	state := GetRebaseState()
+	if state == nil || len(state.Todo) != 1 {
+		t.Fatal("the rebase didn't stop before replaying add new.txt")
+	}
+	if c := GetCommit(state.Todo[0].Hash); c.Subject() != "add new.txt" {
+		t.Errorf("the rebase will replay %q next", c.Subject())
+	}
+}
+
+func TestContinueRebaseWithUnstagedChanges(t *testing.T) {
+	setupStoppedRebase(t)
+	writeFile(t, "a.txt", "resolved\n")
+	gogit(t, "add", "a.txt")
+	writeFile(t, "a.txt", "resolved and changed\n")
+	head := GetHead()
+
+	gogit(t, "rebase", "--continue")
+
+	if GetHead() != head || GetRebaseState() == nil {
+		t.Error("the rebase continued with unstaged changes")
+	}
+	if got := readFile(t, "a.txt"); got != "resolved and changed\n" {
+		t.Errorf("the unstaged change to a.txt was lost, it is %q", got)
+	}
+}
+
+func TestFixupCancellingTheCommit(t *testing.T) {
+	newTestRepo(t)
+	commitFile(t, "a.txt", "base\n", "base")
+	base := GetCommit(GetHead())
+	commitFile(t, "x.txt", "x\n", "add x.txt")
+	add := GetHead()
+	gogit(t, "rm", "x.txt")
+	gogit(t, "commit", "remove x.txt")
+
+	state := &RebaseState{Branch: "MASTER", OrigHead: GetHead(), Onto: base.Hash}
+	state.Todo = []RebaseStep{{"pick", add}, {"fixup", GetHead()}}
+	SaveRebaseState(state)
+	ApplyCommit(base)
+	DetachHead(base)
+	if !RunRebase(state) {
+		t.Fatal("the rebase stopped")
+	}
+
+	head := GetCommit(GetHead())
+	if head.Subject() != "add x.txt" || len(head.PrevCommits) != 1 || head.PrevCommits[0].Hash != base.Hash {
+		t.Fatalf("HEAD is %q instead of add x.txt on top of base", head.Subject())
+	}
+	if head.Tree != base.Tree {
+		t.Error("the fixup wasn't melded into add x.txt")
+	}
+}
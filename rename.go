@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sort"
+
+	"gogit/diff"
+)
+
+const (
+	RenameThreshold = 50   // minimum similarity (in %) of a renamed file
+	RenameLimit     = 1000 // maximum number of file pairs compared by content
+)
+
+// Similarity returns how similar the content of two blobs is in %, based on
+// the number of lines they have in common
+func Similarity(a, b string) int {
+	if a == b {
+		return 100
+	}
+	linesA := SplitLines(string(ReadBlob(a)))
+	linesB := SplitLines(string(ReadBlob(b)))
+	if len(linesA)+len(linesB) == 0 {
+		return 100
+	}
+	common := len(diff.LCS(linesA, linesB))
+	return 200 * common / (len(linesA) + len(linesB))
+}
+
+// DetectRenames pairs the files deleted since base with the files added since
+// base (relative path -> hash, "" for deleted files) and returns the renames
+// as old path -> new path
+func DetectRenames(baseObjects, changes map[string]string) map[string]string {
+	var deleted, added []string
+	for relativePath, hash := range changes {
+		if hash == "" && baseObjects[relativePath] != "" {
+			deleted = append(deleted, relativePath)
+		} else if hash != "" && baseObjects[relativePath] == "" {
+			added = append(added, relativePath)
+		}
+	}
+	sort.Strings(deleted)
+	sort.Strings(added)
+
+	renames := map[string]string{}
+	used := map[string]bool{}
+
+	// exact renames first
+	for _, oldPath := range deleted {
+		for _, newPath := range added {
+			if !used[newPath] && changes[newPath] == baseObjects[oldPath] {
+				renames[oldPath] = newPath
+				used[newPath] = true
+				break
+			}
+		}
+	}
+
+	if len(deleted)*len(added) > RenameLimit {
+		return renames
+	}
+	for _, oldPath := range deleted {
+		if _, ok := renames[oldPath]; ok {
+			continue
+		}
+		best, bestSimilarity := "", RenameThreshold-1
+		for _, newPath := range added {
+			if used[newPath] {
+				continue
+			}
+			if similarity := Similarity(baseObjects[oldPath], changes[newPath]); similarity > bestSimilarity {
+				best, bestSimilarity = newPath, similarity
+			}
+		}
+		if best != "" {
+			renames[oldPath] = best
+			used[best] = true
+		}
+	}
+	return renames
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Revisions name commits. A revision is a name followed by selectors:
+
+		HEAD, @               the current commit
+		<branch>, <tag>       branches/<name> and tags/<name> if both exist
+		<hash>                a unique prefix of at least 4 characters
+		<rev>@{<time>}        the last commit of <rev> (following first
+		                      parents) made at or before the time, which is
+		                      a unix timestamp, a date like 2006-01-02 or
+		                      2006-01-02 15:04:05, or "<n> <unit>s ago"
+		<rev>~<n>             the n-th first parent, ~ is ~1
+		<rev>^<n>             the n-th parent, ^ is ^1 and ^0 is <rev>
+
+	Commands that walk the history also take ranges:
+
+		<a>..<b>              commits before <b> that aren't before <a>
+		<a>...<b>             commits before <a> or <b> but not both
+*/
+
+const minHashPrefix = 4
+
+// ResolveCommit returns the commit named by the revision. It prints why and
+// returns nil if there is none or the revision is ambiguous
+func ResolveCommit(rev string) *Commit {
+	if strings.Contains(rev, "..") {
+		fmt.Printf("%s is a range, a single commit is expected\n", rev)
+		return nil
+	}
+	c, err := resolveRevision(rev)
+	if err != "" {
+		fmt.Println(err)
+		return nil
+	}
+	return c
+}
+
+// ResolveRange returns the commits of a range or revision: the ones before
+// the include commits that aren't before the exclude commits. ok is false if
+// a revision can't be resolved
+func ResolveRange(expr string) (include []*Commit, exclude []*Commit, ok bool) {
+	symmetric := strings.Contains(expr, "...")
+	sep := ".."
+	if symmetric {
+		sep = "..."
+	}
+	parts := strings.SplitN(expr, sep, 2)
+	if len(parts) == 1 {
+		c := ResolveCommit(expr)
+		return []*Commit{c}, nil, c != nil
+	}
+	// a missing end is HEAD like in a..
+	for i := range parts {
+		if parts[i] == "" {
+			parts[i] = "HEAD"
+		}
+	}
+	a, b := ResolveCommit(parts[0]), ResolveCommit(parts[1])
+	if a == nil || b == nil {
+		return nil, nil, false
+	}
+	if symmetric {
+		return []*Commit{a, b}, MergeBases(a, b), true
+	}
+	return []*Commit{b}, []*Commit{a}, true
+}
+
+// RangeCommits returns the commits before the include commits that aren't
+// before the exclude commits, parents before children
+func RangeCommits(include []*Commit, exclude []*Commit) []*Commit {
+	excluded := map[string]bool{}
+	for _, c := range exclude {
+		for hash := range Ancestors(c) {
+			excluded[hash] = true
+		}
+	}
+	var commits []*Commit
+	var visit func(c *Commit)
+	visit = func(c *Commit) {
+		if excluded[c.Hash] {
+			return
+		}
+		excluded[c.Hash] = true
+		for _, parent := range c.PrevCommits {
+			visit(parent)
+		}
+		commits = append(commits, c)
+	}
+	for _, c := range include {
+		visit(c)
+	}
+	return commits
+}
+
+// resolveRevision resolves a revision without ranges, err is a message
+// saying why it failed
+func resolveRevision(rev string) (*Commit, string) {
+	if rev == "" {
+		return nil, "Empty revision"
+	}
+	// the name and @{...} end at the first ~ or ^ outside of the braces
+	end := len(rev)
+	for i := 0; i < len(rev); i++ {
+		if strings.HasPrefix(rev[i:], "@{") {
+			j := strings.IndexByte(rev[i:], '}')
+			if j == -1 {
+				return nil, fmt.Sprintf("Missing } in %s", rev)
+			}
+			i += j
+			continue
+		}
+		if rev[i] == '~' || rev[i] == '^' {
+			end = i
+			break
+		}
+	}
+	c, err := resolveName(rev[:end])
+	if err != "" {
+		return nil, err
+	}
+	selectors := rev[end:]
+	for selectors != "" {
+		op := selectors[0]
+		selectors = selectors[1:]
+		digits := 0
+		for digits < len(selectors) && selectors[digits] >= '0' && selectors[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 0 {
+			var convErr error
+			n, convErr = strconv.Atoi(selectors[:digits])
+			if convErr != nil {
+				return nil, fmt.Sprintf("Invalid number in %s", rev)
+			}
+		}
+		selectors = selectors[digits:]
+		if op == '~' {
+			for i := 0; i < n; i++ {
+				if len(c.PrevCommits) == 0 {
+					return nil, fmt.Sprintf("%s goes past the first commit", rev)
+				}
+				c = c.PrevCommits[0]
+			}
+		} else if n != 0 {
+			if n > len(c.PrevCommits) {
+				return nil, fmt.Sprintf("Commit %s has no parent %d, in %s", ShortHash(c.Hash), n, rev)
+			}
+			c = c.PrevCommits[n-1]
+		}
+	}
+	return c, ""
+}
+
+// resolveName resolves a name optionally followed by @{<time>}
+func resolveName(name string) (*Commit, string) {
+	selector := ""
+	if i := strings.Index(name, "@{"); i != -1 {
+		if !strings.HasSuffix(name, "}") {
+			return nil, fmt.Sprintf("Invalid revision %s", name)
+		}
+		name, selector = name[:i], name[i+2:len(name)-1]
+	}
+	var c *Commit
+	switch {
+	case name == "" || name == "HEAD" || name == "@":
+		c = GetCommit(GetHead())
+		if c == nil {
+			return nil, "No commits yet"
+		}
+	case strings.HasPrefix(name, "branches/"):
+		if branch := strings.TrimPrefix(name, "branches/"); isBranch(branch) {
+			c = GetCommit(GetBranchCommit(branch))
+		}
+	case strings.HasPrefix(name, "tags/"):
+		if tag := GetTag(strings.TrimPrefix(name, "tags/")); tag != nil {
+			c = GetCommit(tag.Target)
+		}
+	default:
+		var err string
+		c, err = resolveShortName(name)
+		if err != "" {
+			return nil, err
+		}
+	}
+	if c == nil {
+		return nil, fmt.Sprintf("Commit %s not found", name)
+	}
+	if selector == "" {
+		return c, ""
+	}
+	t, ok := ParseTime(selector)
+	if !ok {
+		return nil, fmt.Sprintf("Invalid time %s", selector)
+	}
+	for c.Time > t {
+		if len(c.PrevCommits) == 0 {
+			return nil, fmt.Sprintf("No commit of %s at or before %s", name, time.Unix(t, 0).Format("2006-01-02 15:04:05"))
+		}
+		c = c.PrevCommits[0]
+	}
+	return c, ""
+}
+
+// resolveShortName resolves a branch, a tag or a hash prefix
+func resolveShortName(name string) (*Commit, string) {
+	branch := ""
+	if isBranch(name) {
+		branch = GetBranchCommit(name)
+	}
+	tag := GetTag(name)
+	if branch != "" && tag != nil && tag.Target != branch {
+		return nil, fmt.Sprintf("%s is ambiguous, use branches/%s or tags/%s", name, name, name)
+	}
+	if branch != "" {
+		return GetCommit(branch), ""
+	}
+	if tag != nil {
+		return GetCommit(tag.Target), ""
+	}
+	if len(name) < minHashPrefix || strings.Trim(strings.ToLower(name), "0123456789abcdef") != "" {
+		return nil, ""
+	}
+	matches := MatchHashPrefix(strings.ToLower(name))
+	if len(matches) > 1 {
+		sort.Strings(matches)
+		message := fmt.Sprintf("Short hash %s is ambiguous, it matches:", name)
+		for _, hash := range matches {
+			message += fmt.Sprintf("\n  %s %s", ShortHash(hash), GetCommit(hash).Subject())
+		}
+		return nil, message
+	}
+	if len(matches) == 1 {
+		return GetCommit(matches[0]), ""
+	}
+	return nil, ""
+}
+
+// isBranch returns true if there is a branch with the name
+func isBranch(name string) bool {
+	if !ValidRefName(name) {
+		return false
+	}
+	info, err := os.Stat(".gogit/branches/" + name)
+	return err == nil && !info.IsDir()
+}
+
+// MatchHashPrefix returns the hashes of the commits starting with prefix
+func MatchHashPrefix(prefix string) []string {
+	files, err := os.ReadDir(".gogit/commits")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	var matches []string
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), prefix) {
+			matches = append(matches, file.Name())
+		}
+	}
+	return matches
+}
+
+// ParseTime parses a unix timestamp, a date, a date and time, or a relative
+// time like "2 days ago"
+func ParseTime(s string) (int64, bool) {
+	s = strings.TrimSpace(s)
+	if t, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return t, true
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.Unix(), true
+		}
+	}
+	fields := strings.Fields(strings.ReplaceAll(s, ".", " "))
+	if len(fields) != 3 || fields[2] != "ago" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, false
+	}
+	units := map[string]time.Duration{
+		"second": time.Second,
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+		"week":   7 * 24 * time.Hour,
+	}
+	unit, ok := units[strings.TrimSuffix(fields[1], "s")]
+	if !ok {
+		return 0, false
+	}
+	return time.Now().Add(-time.Duration(n) * unit).Unix(), true
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestResolveBranchOutsideBranches(t *testing.T) {
+	newTestRepo(t)
+	commitFile(t, "a.txt", "base\n", "base")
+	head := GetHead()
+
+	for _, rev := range []string{"../commits/" + head, "branches/../commits/" + head, "..", "."} {
+		if c, _ := resolveRevision(rev); c != nil {
+			t.Errorf("%s resolved to %s", rev, ShortHash(c.Hash))
+		}
+	}
+	for _, rev := range []string{"MASTER", "branches/MASTER", head[:8]} {
+		if c, err := resolveRevision(rev); c == nil || c.Hash != head {
+			t.Errorf("%s didn't resolve to HEAD: %s", rev, err)
+		}
+	}
+}
+
+func TestCreateBranchWithInvalidName(t *testing.T) {
+	newTestRepo(t)
+	commitFile(t, "a.txt", "base\n", "base")
+
+	gogit(t, "branch", "create", "a..b")
+
+	if isBranch("a..b") || GetHeadBranch() != "MASTER" {
+		t.Error("a branch with an invalid name was created")
+	}
+}
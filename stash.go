@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gogit/diff"
+)
+
+/*
+	A stash entry is a commit of the working directory whose parents are
+	HEAD and a commit of the index (also on top of HEAD). These commits are
+	not part of the history of any branch, their hashes are listed in
+	.gogit/stash, newest first, and entries are named stash@{n}.
+
+	Untracked files are only stashed with --include-untracked. They are in
+	the tree of the entry but not in the one of its index commit.
+*/
+
+func GetStash() []string {
+	b, err := ioutil.ReadFile(".gogit/stash")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	var hashes []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line != "" {
+			hashes = append(hashes, line)
+		}
+	}
+	return hashes
+}
+
+func SaveStash(hashes []string) {
+	if len(hashes) == 0 {
+		os.Remove(".gogit/stash")
+		return
+	}
+	err := ioutil.WriteFile(".gogit/stash", []byte(strings.Join(hashes, "\n")+"\n"), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ParseStashRef returns the position of a stash entry given as "stash@{n}"
+// or "n", "" is the newest entry. It returns -1 if there is no such entry
+func ParseStashRef(ref string) int {
+	ref = strings.TrimSuffix(strings.TrimPrefix(ref, "stash@{"), "}")
+	n := 0
+	if ref != "" {
+		var err error
+		n, err = strconv.Atoi(ref)
+		if err != nil {
+			n = -1
+		}
+	}
+	if n < 0 || n >= len(GetStash()) {
+		fmt.Printf("No stash entry %s\n", ref)
+		return -1
+	}
+	return n
+}
+
+// StashPush saves the changes of the index and the working directory in a
+// new stash entry and resets the tracked files to HEAD
+func StashPush(message string, includeUntracked bool) bool {
+	head := GetCommit(GetHead())
+	if head == nil {
+		fmt.Println("No commits yet")
+		return false
+	}
+	index := GetIndex()
+	tracked := TrackedPaths(index)
+	headObjects := TreeToMap(head.Tree)
+	for relativePath := range headObjects {
+		tracked[relativePath] = true
+	}
+
+	// untracked files are only stored when they are stashed
+	var objects []Object
+	var untracked []string
+	if includeUntracked {
+		objects = SnapshotPath(".", tracked)
+		for _, object := range objects {
+			if !tracked[object.RelativePath] {
+				untracked = append(untracked, object.RelativePath)
+			}
+		}
+	} else {
+		objects = SnapshotTracked(tracked)
+	}
+	indexTree := BuildTree(IndexObjects(index))
+	workTree := BuildTree(objects)
+	if indexTree == head.Tree && workTree == head.Tree {
+		fmt.Println("No local changes to save")
+		return false
+	}
+
+	prefix := "On "
+	if message == "" {
+		prefix = "WIP on "
+		message = ShortHash(head.Hash) + " " + head.Subject()
+	}
+	branch := GetHeadBranch()
+	if branch == "" {
+		branch = "(no branch)"
+	}
+	message = prefix + branch + ": " + message
+	now := time.Now().Unix()
+	indexCommit := &Commit{User: "user", Tree: indexTree, PrevCommits: []*Commit{head}, Time: now, Message: "index on " + message}
+	indexCommit.Hash = HashCommit(indexCommit.Tree, indexCommit.PrevCommits, indexCommit.Message, now)
+	SaveCommit(indexCommit)
+	stash := &Commit{User: "user", Tree: workTree, PrevCommits: []*Commit{head, indexCommit}, Time: now, Message: message}
+	stash.Hash = HashCommit(stash.Tree, stash.PrevCommits, stash.Message, now)
+	SaveCommit(stash)
+	SaveStash(append([]string{stash.Hash}, GetStash()...))
+
+	ResetHard(head)
+	for _, relativePath := range untracked {
+		os.Remove(relativePath)
+	}
+	fmt.Printf("Saved working directory and index state %s\n", message)
+	return true
+}
+
+// StashApply merges the changes of the stash entry n into the working
+// directory. Files added to the index before stashing are staged again, other
+// changes are left unstaged. With pop the entry is dropped unless there are
+// conflicts
+func StashApply(n int, pop bool) bool {
+	stash := GetCommit(GetStash()[n])
+	head := GetCommit(GetHead())
+	base, indexCommit := stash.PrevCommits[0], stash.PrevCommits[1]
+
+	labels := diff.Labels{Ours: "Updated upstream", Base: "Stash base", Theirs: "Stashed changes"}
+	objects, conflicts, conflictContents := MergeTrees(base.Tree, head.Tree, stash.Tree, labels, diff.FavorNone, false)
+
+	headObjects := TreeToMap(head.Tree)
+	headModes := TreeModes(head.Tree)
+	modes := MergeModes(base.Tree, head.Tree, stash.Tree, objects)
+	for relativePath := range objects {
+		if _, ok := headObjects[relativePath]; ok {
+			continue
+		}
+		if _, err := os.Stat(relativePath); err == nil {
+			fmt.Printf("%s already exists, remove it before applying the stash\n", relativePath)
+			return false
+		}
+	}
+
+	WriteChanges(DiffMaps(headObjects, objects, headModes, modes))
+	for relativePath, content := range conflictContents {
+		err := ioutil.WriteFile(relativePath, []byte(content), 0644)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	stagedObjects := TreeToMap(indexCommit.Tree)
+	for relativePath, hash := range objects {
+		if _, ok := headObjects[relativePath]; !ok && stagedObjects[relativePath] != "" {
+			headObjects[relativePath] = hash
+			headModes[relativePath] = modes[relativePath]
+		}
+	}
+	SaveIndexFromMap(headObjects, headModes)
+	SaveConflicts(conflicts)
+
+	if len(conflicts) != 0 {
+		fmt.Println("Fix the conflicts and add the files, or use reset --hard to go back to HEAD, the stash entry is kept")
+		return false
+	}
+	if pop {
+		StashDrop(n)
+	}
+	return true
+}
+
+// StashDrop removes the stash entry n
+func StashDrop(n int) {
+	hashes := GetStash()
+	fmt.Printf("Dropped stash@{%d} (%s)\n", n, ShortHash(hashes[n]))
+	SaveStash(append(hashes[:n], hashes[n+1:]...))
+}
+
+func LogStash() {
+	for i, hash := range GetStash() {
+		fmt.Printf("stash@{%d}: %s\n", i, GetCommit(hash).Subject())
+	}
+}
+
+// StashShow prints the changes of the stash entry n
+func StashShow(n int, patch bool) {
+	stash := GetCommit(GetStash()[n])
+	diffs := DiffCommits(stash.PrevCommits[0], stash)
+	if patch {
+		LogDiffs(diffs, 3)
+	} else {
+		LogDiffStat(diffs)
+	}
+}
+
+// ResetHard sets the index and the tracked files of the working directory to
+// the files of the commit, untracked files are kept
+func ResetHard(c *Commit) {
+	ApplyMerge(TreeToMap(c.Tree), TreeModes(c.Tree))
+}
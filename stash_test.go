@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestStashDoesNotStoreUntrackedFiles(t *testing.T) {
+	newTestRepo(t)
+	commitFile(t, "a.txt", "base\n", "base")
+	writeFile(t, "a.txt", "changed\n")
+	writeFile(t, "secret.txt", "SECRET\n")
+
+	gogit(t, "stash", "push")
+
+	if len(GetStash()) != 1 {
+		t.Fatal("nothing was stashed")
+	}
+	if HasObject(HashContent([]byte("SECRET\n"))) {
+		t.Error("untracked secret.txt was stored without --include-untracked")
+	}
+	if got := readFile(t, "secret.txt"); got != "SECRET\n" {
+		t.Errorf("untracked secret.txt was changed to %q", got)
+	}
+	if got := readFile(t, "a.txt"); got != "base\n" {
+		t.Errorf("a.txt is %q after stashing", got)
+	}
+}
+
+func TestStashIncludeUntracked(t *testing.T) {
+	newTestRepo(t)
+	commitFile(t, "a.txt", "base\n", "base")
+	writeFile(t, "new.txt", "new\n")
+
+	gogit(t, "stash", "push", "-u")
+	if !HasObject(HashContent([]byte("new\n"))) {
+		t.Error("untracked new.txt wasn't stored with --include-untracked")
+	}
+	gogit(t, "stash", "pop")
+
+	if got := readFile(t, "new.txt"); got != "new\n" {
+		t.Errorf("new.txt is %q after popping the stash", got)
+	}
+	if len(GetStash()) != 0 {
+		t.Error("the stash entry wasn't dropped")
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Conflict is a file that couldn't be merged automatically
+type Conflict struct {
+	Path   string // Relative path of the file
+	Base   string // Hash of the file in the common ancestor ("" if absent)
+	Ours   string // Hash of the file in the branch merged into ("" if absent)
+	Theirs string // Hash of the file in the branch being merged ("" if absent)
+}
+
+func (c *Conflict) Serialize() string {
+	return fmt.Sprintf("%s|%s|%s|%s", c.Base, c.Ours, c.Theirs, c.Path)
+}
+
+// Code returns the two letter status of the conflict, U for the sides that
+// modified the file, A for the ones that added it and D for the ones that
+// deleted it
+func (c *Conflict) Code() string {
+	switch {
+	case c.Base == "" && c.Ours == "":
+		return "UA"
+	case c.Base == "" && c.Theirs == "":
+		return "AU"
+	case c.Base == "":
+		return "AA"
+	case c.Ours == "":
+		return "DU"
+	case c.Theirs == "":
+		return "UD"
+	}
+	return "UU"
+}
+
+func (c *Conflict) Description() string {
+	descriptions := map[string]string{
+		"UA": "added by them:",
+		"AU": "added by us:",
+		"AA": "both added:",
+		"DU": "deleted by us:",
+		"UD": "deleted by them:",
+		"UU": "both modified:",
+	}
+	return descriptions[c.Code()]
+}
+
+func DeserializeConflict(s string) *Conflict {
+	strs := strings.SplitN(s, "|", 4)
+	return &Conflict{strs[3], strs[0], strs[1], strs[2]}
+}
+
+// MergeState is a merge waiting for its conflicts to be resolved
+type MergeState struct {
+	Head    string // Hash of HEAD before the merge
+	Ours    string // Hash of the commit merged into
+	Theirs  string // Hash of the commit being merged
+	Base    string // Hashes of the merge bases separated by commas
+	Message string // Message of the merge commit, "" if the merge isn't committed
+}
+
+func (m *MergeState) Serialize() string {
+	return fmt.Sprintf("%s\n%s\n%s\n%s\n%s", m.Head, m.Ours, m.Theirs, m.Base, m.Message)
+}
+
+func DeserializeMergeState(s string) *MergeState {
+	lines := strings.SplitN(s, "\n", 5)
+	return &MergeState{lines[0], lines[1], lines[2], lines[3], lines[4]}
+}
+
+// GetMergeState returns the merge in progress or nil if there is none
+func GetMergeState() *MergeState {
+	b, err := ioutil.ReadFile(".gogit/MERGE_STATE")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	return DeserializeMergeState(string(b))
+}
+
+func SaveMergeState(m *MergeState) {
+	err := ioutil.WriteFile(".gogit/MERGE_STATE", []byte(m.Serialize()), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ClearMergeState() {
+	os.Remove(".gogit/MERGE_STATE")
+	SaveConflicts(nil)
+}
+
+// RebaseStep is a line of the todo list of a rebase
+type RebaseStep struct {
+	Action string // What to do with the commit (pick, reword, edit, squash or fixup)
+	Hash   string // Hash of the commit
+}
+
+// RebaseState is a rebase in progress
+type RebaseState struct {
+	Branch   string       // Branch being rebased
+	OrigHead string       // Hash of HEAD before the rebase
+	Onto     string       // Hash of the commit the branch is replayed onto
+	Current  RebaseStep   // Step stopped at, for conflicts or to edit a commit
+	Todo     []RebaseStep // Steps left to do
+}
+
+func (r *RebaseState) Serialize() string {
+	return fmt.Sprintf("%s\n%s\n%s\n%s", r.Branch, r.OrigHead, r.Onto, serializeSteps(r.Current, r.Todo))
+}
+
+func DeserializeRebaseState(s string) *RebaseState {
+	lines := strings.Split(s, "\n")
+	state := &RebaseState{Branch: lines[0], OrigHead: lines[1], Onto: lines[2]}
+	state.Current, state.Todo = deserializeSteps(lines[3:])
+	return state
+}
+
+// serializeSteps writes the current step on the first line, empty if there
+// is none, followed by the todo list
+func serializeSteps(current RebaseStep, todo []RebaseStep) string {
+	s := current.Action + " " + current.Hash + "\n"
+	for _, step := range todo {
+		s += step.Action + " " + step.Hash + "\n"
+	}
+	return s
+}
+
+func deserializeSteps(lines []string) (RebaseStep, []RebaseStep) {
+	var current RebaseStep
+	var todo []RebaseStep
+	if fields := strings.Fields(lines[0]); len(fields) == 2 {
+		current = RebaseStep{fields[0], fields[1]}
+	}
+	for _, line := range lines[1:] {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			todo = append(todo, RebaseStep{fields[0], fields[1]})
+		}
+	}
+	return current, todo
+}
+
+// GetRebaseState returns the rebase in progress or nil if there is none
+func GetRebaseState() *RebaseState {
+	b, err := ioutil.ReadFile(".gogit/REBASE_STATE")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	return DeserializeRebaseState(string(b))
+}
+
+func SaveRebaseState(r *RebaseState) {
+	err := ioutil.WriteFile(".gogit/REBASE_STATE", []byte(r.Serialize()), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ClearRebaseState() {
+	os.Remove(".gogit/REBASE_STATE")
+	SaveConflicts(nil)
+}
+
+// PickState is a cherry-pick or a revert in progress
+type PickState struct {
+	Head    string       // Hash of HEAD before the first commit was applied
+	Current RebaseStep   // Step stopped at on conflicts
+	Todo    []RebaseStep // Steps left to do (pick or revert)
+}
+
+func (p *PickState) Serialize() string {
+	return p.Head + "\n" + serializeSteps(p.Current, p.Todo)
+}
+
+func DeserializePickState(s string) *PickState {
+	lines := strings.Split(s, "\n")
+	state := &PickState{Head: lines[0]}
+	state.Current, state.Todo = deserializeSteps(lines[1:])
+	return state
+}
+
+// GetPickState returns the cherry-pick or revert in progress or nil if there
+// is none
+func GetPickState() *PickState {
+	b, err := ioutil.ReadFile(".gogit/PICK_STATE")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	return DeserializePickState(string(b))
+}
+
+func SavePickState(p *PickState) {
+	err := ioutil.WriteFile(".gogit/PICK_STATE", []byte(p.Serialize()), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ClearPickState() {
+	os.Remove(".gogit/PICK_STATE")
+	SaveConflicts(nil)
+}
+
+// InProgress returns the command whose operation is in progress (merge,
+// rebase, cherry-pick or revert) or "" if there is none
+func InProgress() string {
+	if GetRebaseState() != nil {
+		return "rebase"
+	}
+	if state := GetPickState(); state != nil {
+		if state.Current.Action == "revert" {
+			return "revert"
+		}
+		return "cherry-pick"
+	}
+	if GetMergeState() != nil {
+		return "merge"
+	}
+	// only applying a stash leaves conflicts without a state
+	if HasConflicts() {
+		return "stash"
+	}
+	return ""
+}
+
+func GetConflicts() []Conflict {
+	b, err := ioutil.ReadFile(".gogit/MERGE_CONFLICTS")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	var conflicts []Conflict
+	for _, line := range strings.Split(string(b), "\n") {
+		if line != "" {
+			conflicts = append(conflicts, *DeserializeConflict(line))
+		}
+	}
+	return conflicts
+}
+
+func SaveConflicts(conflicts []Conflict) {
+	if len(conflicts) == 0 {
+		os.Remove(".gogit/MERGE_CONFLICTS")
+		return
+	}
+	var content string
+	for _, conflict := range conflicts {
+		content += conflict.Serialize() + "\n"
+	}
+	err := ioutil.WriteFile(".gogit/MERGE_CONFLICTS", []byte(content), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func HasConflicts() bool {
+	return len(GetConflicts()) != 0
+}
+
+// MarkResolved removes the conflicts of the files under the paths
+func MarkResolved(paths []string) {
+	var conflicts []Conflict
+	for _, conflict := range GetConflicts() {
+		resolved := false
+		for _, p := range paths {
+			if IsUnderPath(conflict.Path, NormalizePath(p)) {
+				resolved = true
+			}
+		}
+		if !resolved {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	SaveConflicts(conflicts)
+}
+
+// CheckoutConflicts writes our or their version of the conflicted files under
+// the paths to the working directory. The conflicts stay until the files are
+// added
+func CheckoutConflicts(paths []string, ours bool) {
+	side := "their"
+	if ours {
+		side = "our"
+	}
+	conflicts := GetConflicts()
+	for _, p := range paths {
+		p = NormalizePath(p)
+		found := false
+		for _, conflict := range conflicts {
+			if !IsUnderPath(conflict.Path, p) {
+				continue
+			}
+			found = true
+			hash := conflict.Theirs
+			if ours {
+				hash = conflict.Ours
+			}
+			if hash == "" {
+				fmt.Printf("Path %s does not have %s version\n", conflict.Path, side)
+				continue
+			}
+			WriteBlobToFile(hash, conflict.Path)
+		}
+		if !found {
+			fmt.Printf("Path %s has no conflicts\n", p)
+		}
+	}
+}
+
+func LogConflicts() {
+	for _, conflict := range GetConflicts() {
+		fmt.Printf("\t%s\n", conflict.Path)
+	}
+}
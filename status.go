@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+type Status struct {
+	Branch    string     // Current branch, "" if HEAD is detached
+	Head      string     // Commit HEAD points to
+	Staged    []Change   // Changes between HEAD and the index
+	Unstaged  []Change   // Changes between the index and the working directory
+	Untracked []string   // Files in the working directory that are not in the index
+	Conflicts []Conflict // Files with unresolved merge conflicts
+}
+
+// WorkingTreeObjects hashes the files in the working directory that are
+// tracked or not ignored, and the tracked directories without files, without
+// storing them. It returns their hashes and their modes (relative path ->
+// hash, relative path -> mode)
+func WorkingTreeObjects(tracked map[string]bool) (map[string]string, map[string]string) {
+	objects := map[string]string{}
+	modes := map[string]string{}
+	var paths []string
+	WalkWorkingTree(".", tracked, func(relativePath string, info os.FileInfo) {
+		objects[relativePath] = HashWorkingFile(relativePath)
+		modes[relativePath] = FileModeOf(info)
+		paths = append(paths, relativePath)
+	})
+	for _, dir := range KeptDirs(tracked, paths) {
+		objects[dir] = EmptyTreeHash
+		modes[dir] = DirMode
+	}
+	return objects, modes
+}
+
+// DiffMaps returns the changes between two sets of files (relative path ->
+// hash) with their modes (relative path -> mode, see ModeOf). Files with the
+// same hash and a different mode are changed
+func DiffMaps(a, b map[string]string, aModes, bModes map[string]string) []Change {
+	var changes []Change
+	for relativePath, hash := range a {
+		newHash, ok := b[relativePath]
+		if !ok {
+			changes = append(changes, Change{relativePath, hash, "", ModeOf(aModes, relativePath), ""})
+		} else if newHash != hash || ModeOf(aModes, relativePath) != ModeOf(bModes, relativePath) {
+			changes = append(changes, Change{relativePath, hash, newHash, ModeOf(aModes, relativePath), ModeOf(bModes, relativePath)})
+		}
+	}
+	for relativePath, hash := range b {
+		if _, ok := a[relativePath]; !ok {
+			changes = append(changes, Change{relativePath, "", hash, "", ModeOf(bModes, relativePath)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func GetStatus() *Status {
+	headObjects := map[string]string{}
+	headModes := map[string]string{}
+	if head := GetCommit(GetHead()); head != nil {
+		headObjects = TreeToMap(head.Tree)
+		headModes = TreeModes(head.Tree)
+	}
+	index := GetIndex()
+	indexObjects := map[string]string{}
+	indexModes := map[string]string{}
+	for relativePath, object := range index {
+		indexObjects[relativePath] = object.Hash
+		indexModes[relativePath] = object.Mode
+	}
+	workingObjects, workingModes := WorkingTreeObjects(TrackedPaths(index))
+
+	status := &Status{Branch: GetHeadBranch(), Head: GetHead()}
+	conflicted := map[string]bool{}
+	for _, conflict := range GetConflicts() {
+		status.Conflicts = append(status.Conflicts, conflict)
+		conflicted[conflict.Path] = true
+	}
+	for _, change := range DiffMaps(headObjects, indexObjects, headModes, indexModes) {
+		if !conflicted[change.Path] {
+			status.Staged = append(status.Staged, change)
+		}
+	}
+	for _, change := range DiffMaps(indexObjects, workingObjects, indexModes, workingModes) {
+		if conflicted[change.Path] {
+			continue
+		} else if change.OldHash == "" {
+			status.Untracked = append(status.Untracked, change.Path)
+		} else {
+			status.Unstaged = append(status.Unstaged, change)
+		}
+	}
+	return status
+}
+
+// CheckUnstaged returns false and tells to add or discard the unstaged
+// changes, which the next steps of the command would overwrite, if there are
+// some
+func CheckUnstaged(command string) bool {
+	if len(GetStatus().Unstaged) == 0 {
+		return true
+	}
+	fmt.Printf("Cannot continue the %s with unstaged changes, add or discard them first\n", command)
+	return false
+}
+
+func (s *Status) IsClean() bool {
+	return len(s.Staged) == 0 && len(s.Unstaged) == 0 && len(s.Untracked) == 0 && len(s.Conflicts) == 0
+}
+
+// ChangeCode returns A, M or D for added, modified and deleted files
+func ChangeCode(change Change) string {
+	if change.OldHash == "" {
+		return "A"
+	} else if change.NewHash == "" {
+		return "D"
+	}
+	return "M"
+}
+
+func (s *Status) Log() {
+	if s.Branch != "" {
+		fmt.Printf("On branch %s\n", s.Branch)
+	} else if s.Head != "" {
+		fmt.Printf("HEAD detached at %s\n", ShortHash(s.Head))
+	}
+	if s.IsClean() {
+		fmt.Println("Nothing to commit, working tree clean")
+		return
+	}
+	labels := map[string]string{"A": "new file:", "M": "modified:", "D": "deleted: "}
+	if len(s.Staged) != 0 {
+		fmt.Println("\nChanges to be committed:")
+		for _, change := range s.Staged {
+			fmt.Printf("\t%s   %s\n", labels[ChangeCode(change)], change.Path)
+		}
+	}
+	if len(s.Conflicts) != 0 {
+		fmt.Println("\nUnmerged paths:")
+		for _, conflict := range s.Conflicts {
+			fmt.Printf("\t%-17s %s\n", conflict.Description(), conflict.Path)
+		}
+	}
+	if len(s.Unstaged) != 0 {
+		fmt.Println("\nChanges not staged for commit:")
+		for _, change := range s.Unstaged {
+			fmt.Printf("\t%s   %s\n", labels[ChangeCode(change)], change.Path)
+		}
+	}
+	if len(s.Untracked) != 0 {
+		fmt.Println("\nUntracked files:")
+		for _, relativePath := range s.Untracked {
+			fmt.Printf("\t%s\n", relativePath)
+		}
+	}
+}
+
+// LogPorcelain prints one "XY path" line per file, where X is the staged and
+// Y the unstaged change, and "?? path" for untracked files
+func (s *Status) LogPorcelain() {
+	codes := map[string][]string{} // relative path -> [staged, unstaged]
+	for _, change := range s.Staged {
+		codes[change.Path] = []string{ChangeCode(change), " "}
+	}
+	for _, change := range s.Unstaged {
+		if _, ok := codes[change.Path]; !ok {
+			codes[change.Path] = []string{" ", " "}
+		}
+		codes[change.Path][1] = ChangeCode(change)
+	}
+	for _, conflict := range s.Conflicts {
+		code := conflict.Code()
+		codes[conflict.Path] = []string{code[:1], code[1:]}
+	}
+	var paths []string
+	for relativePath := range codes {
+		paths = append(paths, relativePath)
+	}
+	sort.Strings(paths)
+	for _, relativePath := range paths {
+		fmt.Printf("%s%s %s\n", codes[relativePath][0], codes[relativePath][1], relativePath)
+	}
+	for _, relativePath := range s.Untracked {
+		fmt.Printf("?? %s\n", relativePath)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+	Objects are stored in .gogit/objects/<hash> as:
+
+	- The magic string "GOGIT" followed by one byte with the format version
+	- A zlib stream of "<type> <size>\x00" followed by the content
+
+	The hash is always the SHA-512 of the uncompressed content, so objects
+	written before compression was added keep their names and are read as
+	raw blobs until they are migrated.
+*/
+
+const (
+	ObjectMagic   = "GOGIT"
+	ObjectVersion = 1
+
+	BlobObject = "blob"
+	TreeObject = "tree"
+	TagObject  = "tag"
+)
+
+func ObjectPath(hash string) string {
+	return ".gogit/objects/" + hash
+}
+
+func HasObject(hash string) bool {
+	if IsPacked(hash) {
+		return true
+	}
+	_, err := os.Stat(ObjectPath(hash))
+	return err == nil
+}
+
+func EncodeObject(objType string, content []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(ObjectMagic)
+	buf.WriteByte(ObjectVersion)
+	w := zlib.NewWriter(&buf)
+	fmt.Fprintf(w, "%s %d\x00", objType, len(content))
+	w.Write(content)
+	err := w.Close()
+	if err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func DecodeObject(b []byte) (string, []byte) {
+	objType, content, ok := decodeObject(b)
+	if !ok {
+		// objects from before the header was added are raw blobs, which
+		// can start with the magic string too, like a file reading
+		// "GOGIT rocks"
+		return BlobObject, b
+	}
+	return objType, content
+}
+
+// IsEncodedObject returns true if b is an object in the current format
+func IsEncodedObject(b []byte) bool {
+	_, _, ok := decodeObject(b)
+	return ok
+}
+
+// decodeObject returns false if b isn't the magic string and the version
+// followed by a valid zlib stream with the type and size of the content
+func decodeObject(b []byte) (string, []byte, bool) {
+	n := len(ObjectMagic)
+	if len(b) < n+3 || string(b[:n]) != ObjectMagic || b[n] != ObjectVersion {
+		return "", nil, false
+	}
+	// deflate compression and a header that is a multiple of 31
+	cmf, flg := b[n+1], b[n+2]
+	if cmf&0x0f != 8 || (uint16(cmf)<<8|uint16(flg))%31 != 0 {
+		return "", nil, false
+	}
+	r, err := zlib.NewReader(bytes.NewReader(b[n+1:]))
+	if err != nil {
+		return "", nil, false
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", nil, false
+	}
+	i := bytes.IndexByte(data, 0)
+	if i == -1 {
+		return "", nil, false
+	}
+	header := strings.Split(string(data[:i]), " ")
+	if len(header) != 2 {
+		return "", nil, false
+	}
+	size, err := strconv.Atoi(header[1])
+	content := data[i+1:]
+	if err != nil || len(content) != size {
+		return "", nil, false
+	}
+	return header[0], content, true
+}
+
+// WriteObject stores the content and returns its hash
+func WriteObject(objType string, content []byte) string {
+	hash := HashContent(content)
+	if HasObject(hash) {
+		return hash
+	}
+	err := ioutil.WriteFile(ObjectPath(hash), EncodeObject(objType, content), 0644)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// ReadObject looks for the object in the packs before the loose objects
+func ReadObject(hash string) (string, []byte) {
+	if objType, content, ok := ReadPackedObject(hash); ok {
+		return objType, content
+	}
+	b, err := ioutil.ReadFile(ObjectPath(hash))
+	if err != nil {
+		panic(err)
+	}
+	return DecodeObject(b)
+}
+
+func ReadBlob(hash string) []byte {
+	_, content := ReadObject(hash)
+	return content
+}
+
+func WriteBlobFromFile(path string) string {
+	return WriteObject(BlobObject, ReadWorkingFile(path))
+}
+
+// WriteBlobToFile writes the blob to path, creating its parent directories
+func WriteBlobToFile(hash string, path string) {
+	makeParentDirs(path)
+	err := ioutil.WriteFile(path, ReadBlob(hash), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func makeParentDirs(path string) {
+	if dir := filepath.Dir(path); dir != "." {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// WriteBlobWithMode writes the blob to path as a file with the mode, or as a
+// symlink to the content of the blob
+func WriteBlobWithMode(hash string, path string, mode string) {
+	// writing to a symlink would write to its target
+	if info, err := os.Lstat(path); err == nil && (info.Mode()&os.ModeSymlink != 0 || mode == SymlinkMode) {
+		os.Remove(path)
+	}
+	if mode == SymlinkMode {
+		makeParentDirs(path)
+		err := os.Symlink(string(ReadBlob(hash)), path)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	WriteBlobToFile(hash, path)
+	perm := os.FileMode(0644)
+	if mode == ExecutableMode {
+		perm = 0755
+	}
+	err := os.Chmod(path, perm)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// MigrateObjects rewrites the uncompressed objects in .gogit/objects with the
+// current format and returns how many were rewritten. Commits from before
+// trees must be migrated first, see MigrateCommits
+func MigrateObjects() int {
+	trees := map[string]bool{}
+	for _, commit := range *GetAllCommits() {
+		findTrees(commit.Tree, trees)
+	}
+
+	files, err := os.ReadDir(".gogit/objects")
+	if err != nil {
+		panic(err)
+	}
+	count := 0
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(".gogit/objects", file.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+		if IsEncodedObject(b) {
+			continue
+		}
+		objType := BlobObject
+		if trees[file.Name()] {
+			objType = TreeObject
+		}
+		// write to a temporary file first so an interrupted migration
+		// never leaves a truncated object behind
+		err = ioutil.WriteFile(path+".tmp", EncodeObject(objType, b), 0644)
+		if err != nil {
+			panic(err)
+		}
+		err = os.Rename(path+".tmp", path)
+		if err != nil {
+			panic(err)
+		}
+		count++
+	}
+	return count
+}
+
+func findTrees(hash string, trees map[string]bool) {
+	if trees[hash] {
+		return
+	}
+	trees[hash] = true
+	for _, entry := range GetTree(hash).Entries {
+		if entry.Type == TreeEntry {
+			findTrees(entry.Hash, trees)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestLegacyBlobStartingWithMagic(t *testing.T) {
+	newTestRepo(t)
+	for _, content := range []string{"GOGIT rocks\n", "GOGIT\x01", "GOGIT\x01x\x9c"} {
+		hash := HashContent([]byte(content))
+		if err := ioutil.WriteFile(ObjectPath(hash), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(ReadBlob(hash)); got != content {
+			t.Errorf("legacy blob %q read as %q", content, got)
+		}
+		if n := MigrateObjects(); n != 1 {
+			t.Errorf("migrated %d objects instead of legacy blob %q", n, content)
+		}
+		b, err := ioutil.ReadFile(ObjectPath(hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if objType, got := DecodeObject(b); objType != BlobObject || string(got) != content {
+			t.Errorf("legacy blob %q migrated to a %s of %q", content, objType, got)
+		}
+	}
+}
+
+func TestEncodeObject(t *testing.T) {
+	for _, content := range []string{"", "GOGIT rocks\n", "some\x00binary\xff"} {
+		b := EncodeObject(BlobObject, []byte(content))
+		if !IsEncodedObject(b) {
+			t.Errorf("%q isn't recognized once encoded", content)
+		}
+		if objType, got := DecodeObject(b); objType != BlobObject || string(got) != content {
+			t.Errorf("%q decoded as a %s of %q", content, objType, got)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Tags are stored in .gogit/tags/<name>, separately from the branches, and
+	never move. A lightweight tag holds the hash of the commit it names. An
+	annotated tag holds the hash of a tag object in the object store whose
+	content is:
+
+		<target commit hash>
+		<tag name>
+		<tagger>
+		<time>
+		<message>
+*/
+
+type Tag struct {
+	Name    string // Name of the tag
+	Hash    string // Hash of the tag object, "" for a lightweight tag
+	Target  string // Hash of the tagged commit
+	Tagger  string // User who made an annotated tag
+	Time    int64  // Time of an annotated tag
+	Message string // Message of an annotated tag
+}
+
+func (t *Tag) Serialize() string {
+	return fmt.Sprintf("%s\n%s\n%s\n%d\n%s", t.Target, t.Name, t.Tagger, t.Time, t.Message)
+}
+
+func DeserializeTag(s string) *Tag {
+	lines := strings.SplitN(s, "\n", 5)
+	if len(lines) < 5 {
+		panic("Invalid tag")
+	}
+	tagTime, err := strconv.ParseInt(lines[3], 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return &Tag{Name: lines[1], Target: lines[0], Tagger: lines[2], Time: tagTime, Message: lines[4]}
+}
+
+func TagPath(name string) string {
+	return ".gogit/tags/" + name
+}
+
+// GetTag returns the tag with the name, or nil if there is none
+func GetTag(name string) *Tag {
+	if !ValidRefName(name) {
+		return nil
+	}
+	b, err := ioutil.ReadFile(TagPath(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	hash := strings.TrimSpace(string(b))
+	// commits aren't in the object store, so only annotated tags are
+	if HasObject(hash) {
+		if objType, content := ReadObject(hash); objType == TagObject {
+			tag := DeserializeTag(string(content))
+			tag.Hash = hash
+			return tag
+		}
+	}
+	return &Tag{Name: name, Target: hash}
+}
+
+// GetAllTags returns the tags sorted by name
+func GetAllTags() []*Tag {
+	files, err := os.ReadDir(".gogit/tags")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	var tags []*Tag
+	for _, file := range files {
+		tags = append(tags, GetTag(file.Name()))
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	return tags
+}
+
+// CreateTag tags the commit. The tag is annotated if message isn't empty. It
+// returns false if the name is already used
+func CreateTag(name string, c *Commit, tagger string, message string, tagTime int64) bool {
+	if !ValidRefName(name) {
+		fmt.Printf("Invalid tag name %q\n", name)
+		return false
+	}
+	if GetTag(name) != nil {
+		fmt.Printf("Tag %s already exists\n", name)
+		return false
+	}
+	ref := c.Hash
+	if message != "" {
+		tag := &Tag{Name: name, Target: c.Hash, Tagger: tagger, Time: tagTime, Message: message}
+		ref = WriteObject(TagObject, []byte(tag.Serialize()))
+	}
+	err := os.MkdirAll(".gogit/tags", 0755)
+	if err != nil {
+		panic(err)
+	}
+	err = ioutil.WriteFile(TagPath(name), []byte(ref), 0644)
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+// ValidRefName returns false for names of tags or branches that can't be
+// stored as a file in .gogit/tags or .gogit/branches or that would be read as
+// a revision expression (see rev.go)
+func ValidRefName(name string) bool {
+	switch name {
+	case "", ".", "..", "@", "HEAD":
+		return false
+	}
+	return !strings.ContainsAny(name, "/~^ \t\n") && !strings.Contains(name, "..") && !strings.Contains(name, "@{")
+}
+
+// DeleteTag removes the tag, it returns false if there is none
+func DeleteTag(name string) bool {
+	tag := GetTag(name)
+	if tag == nil {
+		fmt.Printf("Tag %s not found\n", name)
+		return false
+	}
+	os.Remove(TagPath(name))
+	fmt.Printf("Deleted tag %s (was %s)\n", name, ShortHash(tag.Target))
+	return true
+}
+
+func LogTags() {
+	for _, tag := range GetAllTags() {
+		fmt.Println(tag.Name)
+	}
+}
+
+// LogTagsWithSubjects prints every tag with the first line of its message, or
+// of the message of the tagged commit for lightweight tags
+func LogTagsWithSubjects() {
+	for _, tag := range GetAllTags() {
+		subject := ""
+		if tag.Hash != "" {
+			subject = strings.SplitN(tag.Message, "\n", 2)[0]
+		} else if c := GetCommit(tag.Target); c != nil {
+			subject = c.Subject()
+		}
+		fmt.Printf("%-15s %s\n", tag.Name, subject)
+	}
+}
+
+// LogTag prints an annotated tag
+func (t *Tag) LogTag() {
+	fmt.Printf("Tag: %s\n", t.Name)
+	fmt.Printf("Tagger: %s\n", t.Tagger)
+	fmt.Printf("Date: %s\n", time.Unix(t.Time, 0))
+	fmt.Printf("Message: %s\n\n", t.Message)
+}
+
+// RefNames returns the names of HEAD, the branches and the tags pointing to
+// each commit (hash -> names) to decorate logs
+func RefNames() map[string][]string {
+	names := map[string][]string{}
+	head, headBranch := GetHead(), GetHeadBranch()
+	if head != "" && headBranch == "" {
+		names[head] = append(names[head], "HEAD")
+	}
+	files, err := os.ReadDir(".gogit/branches")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		hash := GetBranchCommit(file.Name())
+		if file.Name() == headBranch {
+			names[hash] = append([]string{"HEAD -> " + file.Name()}, names[hash]...)
+		} else {
+			names[hash] = append(names[hash], file.Name())
+		}
+	}
+	for _, tag := range GetAllTags() {
+		names[tag.Target] = append(names[tag.Target], "tag: "+tag.Name)
+	}
+	return names
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	BlobEntry = BlobObject
+	TreeEntry = TreeObject
+)
+
+type Entry struct {
+	Type string // Type of the entry (blob or tree)
+	Hash string // Hash of the blob or sub-tree
+	Name string // Name of the file or directory
+	Mode string // Mode of a blob (see object.go), "" for trees
+}
+
+// EmptyTreeHash is the hash of a tree without entries
+var EmptyTreeHash = HashContent(nil)
+
+type Tree struct {
+	Entries []Entry // Entries sorted by name
+}
+
+type Change struct {
+	Path    string // Relative path of the file
+	OldHash string // Hash before the change ("" if the file was added)
+	NewHash string // Hash after the change ("" if the file was deleted)
+	OldMode string // Mode before the change ("" if the file was added)
+	NewMode string // Mode after the change ("" if the file was deleted)
+}
+
+func (e *Entry) Serialize() string {
+	return fmt.Sprintf("%s|%s|%s", withMode(e.Type, e.Mode), e.Hash, e.Name)
+}
+
+func DeserializeEntry(s string) *Entry {
+	strs := strings.SplitN(s, "|", 3)
+	entryType, mode := splitMode(strs[0])
+	if entryType == TreeEntry {
+		mode = ""
+	}
+	return &Entry{entryType, strs[1], strs[2], mode}
+}
+
+func (t *Tree) Serialize() string {
+	var lines []string
+	for _, entry := range t.Entries {
+		lines = append(lines, entry.Serialize())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func DeserializeTree(s string) *Tree {
+	tree := &Tree{}
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" {
+			tree.Entries = append(tree.Entries, *DeserializeEntry(line))
+		}
+	}
+	return tree
+}
+
+func SaveTree(t *Tree) string {
+	return WriteObject(TreeObject, []byte(t.Serialize()))
+}
+
+func GetTree(hash string) *Tree {
+	if hash == "" {
+		return &Tree{}
+	}
+	_, content := ReadObject(hash)
+	return DeserializeTree(string(content))
+}
+
+// BuildTree saves the tree objects for a flat list of objects and returns the
+// hash of the root tree
+func BuildTree(objects []Object) string {
+	files := map[string]Object{}  // name -> object
+	dirs := map[string][]Object{} // name -> objects relative to the directory
+	for _, object := range objects {
+		strs := strings.SplitN(object.RelativePath, "/", 2)
+		if len(strs) == 1 {
+			files[strs[0]] = object
+		} else {
+			dirs[strs[0]] = append(dirs[strs[0]], Object{object.Hash, strs[1], object.Mode})
+		}
+	}
+
+	tree := &Tree{}
+	for name, object := range files {
+		if object.Mode == DirMode {
+			// a kept directory with files in it is an ordinary directory
+			if _, ok := dirs[name]; !ok {
+				tree.Entries = append(tree.Entries, Entry{TreeEntry, SaveTree(&Tree{}), name, ""})
+			}
+			continue
+		}
+		tree.Entries = append(tree.Entries, Entry{BlobEntry, object.Hash, name, object.Mode})
+	}
+	for name, dirObjects := range dirs {
+		tree.Entries = append(tree.Entries, Entry{TreeEntry, BuildTree(dirObjects), name, ""})
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return tree.Entries[i].Name < tree.Entries[j].Name
+	})
+	return SaveTree(tree)
+}
+
+// FlattenTree returns every file in the tree as an object relative to prefix
+func FlattenTree(hash string, prefix string) []Object {
+	var objects []Object
+	for _, entry := range GetTree(hash).Entries {
+		entryPath := path.Join(prefix, entry.Name)
+		if entry.Type == TreeEntry && entry.Hash == EmptyTreeHash {
+			objects = append(objects, Object{entry.Hash, entryPath, DirMode})
+		} else if entry.Type == TreeEntry {
+			objects = append(objects, FlattenTree(entry.Hash, entryPath)...)
+		} else {
+			objects = append(objects, Object{entry.Hash, entryPath, entry.Mode})
+		}
+	}
+	return objects
+}
+
+func TreeToMap(hash string) map[string]string {
+	objects := map[string]string{} // relative path -> hash
+	for _, object := range FlattenTree(hash, "") {
+		objects[object.RelativePath] = object.Hash
+	}
+	return objects
+}
+
+// TreeModes returns the mode of every file in the tree (relative path -> mode)
+func TreeModes(hash string) map[string]string {
+	modes := map[string]string{}
+	for _, object := range FlattenTree(hash, "") {
+		modes[object.RelativePath] = object.Mode
+	}
+	return modes
+}
+
+// GetTreeObject returns the hash of the file at relativePath or "" if the
+// tree doesn't contain it
+func GetTreeObject(hash string, relativePath string) string {
+	names := strings.Split(path.Clean(relativePath), "/")
+	for i, name := range names {
+		found := false
+		for _, entry := range GetTree(hash).Entries {
+			if entry.Name != name {
+				continue
+			}
+			if i == len(names)-1 {
+				if entry.Type == BlobEntry {
+					return entry.Hash
+				}
+				return ""
+			}
+			if entry.Type != TreeEntry {
+				return ""
+			}
+			hash = entry.Hash
+			found = true
+			break
+		}
+		if !found {
+			return ""
+		}
+	}
+	return ""
+}
+
+// DiffTrees returns the files that differ between the trees a and b, skipping
+// sub-trees that have the same hash in both
+func DiffTrees(a, b string) []Change {
+	changes := diffTrees(a, b, "")
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func diffTrees(a, b string, prefix string) []Change {
+	if a == b {
+		return nil
+	}
+	aEntries := map[string]Entry{}
+	for _, entry := range GetTree(a).Entries {
+		aEntries[entry.Name] = entry
+	}
+	bEntries := map[string]Entry{}
+	for _, entry := range GetTree(b).Entries {
+		bEntries[entry.Name] = entry
+	}
+
+	var changes []Change
+	for name, aEntry := range aEntries {
+		bEntry, ok := bEntries[name]
+		if !ok {
+			bEntry = Entry{}
+		}
+		changes = append(changes, diffEntries(aEntry, bEntry, path.Join(prefix, name))...)
+	}
+	for name, bEntry := range bEntries {
+		if _, ok := aEntries[name]; !ok {
+			changes = append(changes, diffEntries(Entry{}, bEntry, path.Join(prefix, name))...)
+		}
+	}
+	return changes
+}
+
+func diffEntries(a, b Entry, entryPath string) []Change {
+	if a.Type == b.Type && a.Hash == b.Hash && a.Mode == b.Mode {
+		return nil
+	}
+	var changes []Change
+	aTree, bTree := "", ""
+	aBlob, bBlob := "", ""
+	aMode, bMode := "", ""
+	// empty directories are compared like files
+	if a.Type == TreeEntry && a.Hash == EmptyTreeHash {
+		aBlob, aMode = a.Hash, DirMode
+	} else if a.Type == TreeEntry {
+		aTree = a.Hash
+	} else {
+		aBlob, aMode = a.Hash, a.Mode
+	}
+	if b.Type == TreeEntry && b.Hash == EmptyTreeHash {
+		bBlob, bMode = b.Hash, DirMode
+	} else if b.Type == TreeEntry {
+		bTree = b.Hash
+	} else {
+		bBlob, bMode = b.Hash, b.Mode
+	}
+	if aBlob != bBlob || aMode != bMode {
+		changes = append(changes, Change{entryPath, aBlob, bBlob, aMode, bMode})
+	}
+	changes = append(changes, diffTrees(aTree, bTree, entryPath)...)
+	return changes
+}
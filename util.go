@@ -2,9 +2,8 @@ package main
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
-	"strconv"
-	"strings"
 )
 
 func FileToString(f *os.File) string {
@@ -23,42 +22,39 @@ func FileToString(f *os.File) string {
 	return str
 }
 
-func CopyFile(src string, dst string) {
-	srcFile, err := os.Open(src)
+// ReadWorkingFile returns the content of a file of the working directory, the
+// content of a symlink is its target
+func ReadWorkingFile(path string) []byte {
+	info, err := os.Lstat(path)
 	if err != nil {
 		panic(err)
 	}
-	defer srcFile.Close()
-	dstFile, err := os.Create(dst)
-	if err != nil {
-		panic(err)
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			panic(err)
+		}
+		return []byte(target)
 	}
-	defer dstFile.Close()
-	io.Copy(dstFile, srcFile)
-}
-
-func GetMessageFromCommitFile(commitHash string) string {
-	commitFile, err := os.OpenFile(".gogit/commits/"+commitHash, os.O_RDONLY, 0644)
+	content, err := ioutil.ReadFile(path)
 	if err != nil {
 		panic(err)
 	}
-	commitString := FileToString(commitFile)
-	lines := strings.Split(commitString, "\n")
-	return lines[len(lines)-2]
+	return content
 }
 
-func GetTimeFromCommitFile(commitHash string) int64 {
-	commitFile, err := os.OpenFile(".gogit/commits/"+commitHash, os.O_RDONLY, 0644)
+func CopyFile(src string, dst string) {
+	srcFile, err := os.Open(src)
 	if err != nil {
 		panic(err)
 	}
-	commitString := FileToString(commitFile)
-	lines := strings.Split(commitString, "\n")
-	time, err := strconv.ParseInt(lines[len(lines)-3], 10, 64)
+	defer srcFile.Close()
+	dstFile, err := os.Create(dst)
 	if err != nil {
 		panic(err)
 	}
-	return time
+	defer dstFile.Close()
+	io.Copy(dstFile, srcFile)
 }
 
 func AreStringsArraysEqual(a []string, b []string) bool {